@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/cyningsun/edge/internal/cache/disk"
+)
+
+var _ Store = &diskStore{}
+
+// diskStore is a Store on local disk, using an append-only log with
+// in-memory index. Values are encoded by codec.
+type diskStore struct {
+	log   *disk.Log
+	codec Codec
+}
+
+// NewDiskStore opens or creates the store at path.
+func NewDiskStore(path string, codec Codec) (*diskStore, error) {
+	if codec == nil {
+		return nil, errors.New("disk store codec invalid")
+	}
+	log, err := disk.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &diskStore{
+		log:   log,
+		codec: codec,
+	}, nil
+}
+
+func (d *diskStore) Load(key string) (val interface{}, ok bool, err error) {
+	data, ok, err := d.log.Get(key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	val, err = d.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+func (d *diskStore) Store(key string, val interface{}) error {
+	data, err := d.codec.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return d.log.Put(key, data)
+}
+
+func (d *diskStore) Delete(key string) error {
+	_, err := d.log.Delete(key)
+	return err
+}
+
+// Exists returns whether the key exists, without reading disk.
+func (d *diskStore) Exists(key string) bool {
+	return d.log.Exists(key)
+}
+
+// Len returns how many keys are stored.
+func (d *diskStore) Len() int {
+	return d.log.Len()
+}
+
+// Compact reclaims disk space used by overwritten and deleted values.
+func (d *diskStore) Compact() error {
+	return d.log.Compact()
+}
+
+func (d *diskStore) Close() error {
+	return d.log.Close()
+}
@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"expvar"
+)
+
+var m = struct {
+	TraceDrop     *expvar.Int
+	TieredPromote *expvar.Int
+	TieredDemote  *expvar.Int
+	TieredError   *expvar.Int
+	StoreError    *expvar.Int
+}{
+	TraceDrop:     expvar.NewInt("cache.trace.drop"),
+	TieredPromote: expvar.NewInt("cache.tiered.promote"),
+	TieredDemote:  expvar.NewInt("cache.tiered.demote"),
+	TieredError:   expvar.NewInt("cache.tiered.error"),
+	StoreError:    expvar.NewInt("cache.store.error"),
+}
@@ -18,6 +18,9 @@ type cache struct {
 	segmentMask  uint32
 	segmentShift uint32
 	capacity     int
+
+	tracer *tracer
+	shards *shards
 }
 
 type normalize struct {
@@ -28,19 +31,16 @@ type normalize struct {
 }
 
 func NewLRU(opts ...Opt) (*cache, error) {
-	options := &options{
-		concurrency: 16,
-		capacity:    8192,
-	}
-	for _, each := range opts {
-		each(options)
-	}
-
+	options := newOptions(opts...)
 	switch {
 	case options.capacity <= 0:
 		return nil, errors.New("lru capacity invalid")
 	case options.concurrency <= 0:
 		return nil, errors.New("lru concurrency invalid")
+	case options.traceWriter != nil && (options.traceRate <= 0 || options.traceRate > 1):
+		return nil, errors.New("lru trace sample rate invalid")
+	case options.mrcRate < 0 || options.mrcRate > 1:
+		return nil, errors.New("lru miss ratio curve sample rate invalid")
 	}
 
 	if options.concurrency > maxSegments {
@@ -58,12 +58,19 @@ func NewLRU(opts ...Opt) (*cache, error) {
 	for i := range segments {
 		segments[i] = lru.NewSegment(normalize.cap)
 	}
-	return &cache{
+	c := &cache{
 		segments:     segments,
 		segmentMask:  normalize.mask,
 		segmentShift: normalize.shift,
 		capacity:     normalize.cap * normalize.size,
-	}, nil
+	}
+	if options.traceWriter != nil {
+		c.tracer = newTracer(options.traceWriter, options.traceRate)
+	}
+	if options.mrcRate > 0 {
+		c.shards = newShards(c.capacity, options.mrcRate)
+	}
+	return c, nil
 }
 
 func bitwiseOpt(concurrency, capacity int) *normalize {
@@ -90,23 +97,76 @@ func bitwiseOpt(concurrency, capacity int) *normalize {
 }
 
 func (c *cache) Set(key string, val interface{}) interface{} {
-	seg := c.segmentFor(key)
-	return seg.Set(key, val)
+	h := hashOf(key)
+	old := c.segmentFor(h).Set(key, val)
+	c.observe(traceSet, h, key, val, old != nil)
+	return old
 }
 
 func (c *cache) Get(key string) (value interface{}, ok bool) {
-	seg := c.segmentFor(key)
-	return seg.Get(key)
+	h := hashOf(key)
+	value, ok = c.segmentFor(h).Get(key)
+	c.observe(traceGet, h, key, value, ok)
+	return value, ok
 }
 
 func (c *cache) Delete(key string) (present bool) {
-	seg := c.segmentFor(key)
-	return seg.Delete(key)
+	h := hashOf(key)
+	present = c.segmentFor(h).Delete(key)
+	c.observe(traceDelete, h, key, nil, present)
+	return present
+}
+
+// SetIfAbsent saves value under the key only if key not exist, so the
+// first writer wins. If key already exist, <existing value, true> will be
+// return, otherwise <val, false> will be return
+func (c *cache) SetIfAbsent(key string, val interface{}) (actual interface{}, loaded bool) {
+	h := hashOf(key)
+	actual, loaded = c.segmentFor(h).SetIfAbsent(key, val)
+	c.observe(traceSet, h, key, actual, loaded)
+	return actual, loaded
+}
+
+// Replace saves value under the key only if key already exist.
+// If key not exist, <nil, false> will be return
+func (c *cache) Replace(key string, val interface{}) (old interface{}, replaced bool) {
+	h := hashOf(key)
+	old, replaced = c.segmentFor(h).Replace(key, val)
+	c.observe(traceSet, h, key, val, replaced)
+	return old, replaced
+}
+
+// CompareAndSwap saves new under the key only if key exist and its value
+// equals to old. Values of uncomparable type, such as slice, or holding
+// one in an interface field, never equal.
+func (c *cache) CompareAndSwap(key string, old, new interface{}) (swapped bool) {
+	h := hashOf(key)
+	swapped = c.segmentFor(h).CompareAndSwap(key, old, new)
+	c.observe(traceSet, h, key, new, swapped)
+	return swapped
+}
+
+// Compute atomically updates value under the key. fn is called with the
+// current value and whether key exists, the value it returns will be
+// saved if keep is true, otherwise the key will be deleted.
+// fn must not access the cache, as it holds the lock of the key.
+func (c *cache) Compute(key string, fn func(old interface{}, exists bool) (val interface{}, keep bool)) (val interface{}, ok bool) {
+	h := hashOf(key)
+	existed := false
+	val, ok = c.segmentFor(h).Compute(key, func(old interface{}, exists bool) (interface{}, bool) {
+		existed = exists
+		return fn(old, exists)
+	})
+	if ok {
+		c.observe(traceSet, h, key, val, existed)
+	} else {
+		c.observe(traceDelete, h, key, nil, existed)
+	}
+	return val, ok
 }
 
 func (c *cache) Exists(key string) bool {
-	seg := c.segmentFor(key)
-	return seg.Exists(key)
+	return c.segmentFor(hashOf(key)).Exists(key)
 }
 
 func (c *cache) Cap() int {
@@ -121,9 +181,84 @@ func (c *cache) Len() int {
 	return len
 }
 
-func (c *cache) segmentFor(key string) *lru.Segment {
+// OnEvict registers fn to be called with every entry evicted for capacity.
+// fn is called under the lock of the segment evicting, so it must not
+// access the cache.
+func (c *cache) OnEvict(fn func(key string, val interface{})) {
+	for _, each := range c.segments {
+		each.OnEvict(fn)
+	}
+}
+
+// MissRatioCurve returns the estimated miss ratio at capacities from a
+// fraction up to several times of Cap(). It is nil unless WithMissRatioCurve
+// is set and some keys have been sampled.
+func (c *cache) MissRatioCurve() []CurvePoint {
+	if c.shards == nil {
+		return nil
+	}
+	return c.shards.curve()
+}
+
+// Stats is a snapshot of cache state.
+type Stats struct {
+	Len            int
+	Cap            int
+	MissRatioCurve []CurvePoint `json:",omitempty"`
+}
+
+// Stats returns current state of the cache.
+func (c *cache) Stats() Stats {
+	return Stats{
+		Len:            c.Len(),
+		Cap:            c.Cap(),
+		MissRatioCurve: c.MissRatioCurve(),
+	}
+}
+
+// Close stops background work of the cache, such as trace recording,
+// and flushes everything buffered.
+func (c *cache) Close() error {
+	if c.tracer != nil {
+		return c.tracer.Close()
+	}
+	return nil
+}
+
+// observe feeds sampled operations into trace recorder and miss ratio curve.
+func (c *cache) observe(op traceOp, h uint32, key string, val interface{}, hit bool) {
+	traced := c.tracer != nil && c.tracer.sampled(h)
+	tracked := c.shards != nil && c.shards.sampled(h)
+	if !traced && !tracked {
+		return
+	}
+
+	id := keyID(key)
+	if traced {
+		c.tracer.record(op, id, val, hit)
+	}
+	if tracked {
+		if op == traceDelete {
+			c.shards.remove(id)
+		} else {
+			c.shards.access(id, h, op == traceGet)
+		}
+	}
+}
+
+func (c *cache) segmentFor(hash uint32) *lru.Segment {
+	return c.segments[(hash>>c.segmentShift)&c.segmentMask]
+}
+
+func hashOf(key string) uint32 {
 	h := fnv.New32a()
 	_, _ = h.Write([]byte(key))
-	hash := h.Sum32()
-	return c.segments[(hash>>c.segmentShift)&c.segmentMask]
+	return h.Sum32()
+}
+
+// keyID is a wider hash of key, used to identify sampled keys.
+func keyID(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
 }
@@ -3,6 +3,7 @@ package cache
 import (
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/cyningsun/edge/internal/cache/lru"
@@ -389,3 +390,117 @@ func TestLRU_Exist(t *testing.T) {
 		}
 	}
 }
+
+func TestLRU_SetIfAbsent(t *testing.T) {
+	l, err := NewLRU(WithCapacity(8192))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if actual, loaded := l.SetIfAbsent("key", 1); loaded || actual != 1 {
+		t.Fatalf("SetIfAbsent expected: 1, false, got: %v, %v", actual, loaded)
+	}
+	if actual, loaded := l.SetIfAbsent("key", 2); !loaded || actual != 1 {
+		t.Fatalf("SetIfAbsent expected: 1, true, got: %v, %v", actual, loaded)
+	}
+	if val, _ := l.Get("key"); val != 1 {
+		t.Fatalf("Get expected: 1, got: %v", val)
+	}
+}
+
+func TestLRU_Replace(t *testing.T) {
+	l, err := NewLRU(WithCapacity(8192))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if old, replaced := l.Replace("key", 1); replaced || old != nil {
+		t.Fatalf("Replace expected: nil, false, got: %v, %v", old, replaced)
+	}
+	if l.Exists("key") {
+		t.Fatalf("Replace should not add key")
+	}
+	l.Set("key", 1)
+	if old, replaced := l.Replace("key", 2); !replaced || old != 1 {
+		t.Fatalf("Replace expected: 1, true, got: %v, %v", old, replaced)
+	}
+	if val, _ := l.Get("key"); val != 2 {
+		t.Fatalf("Get expected: 2, got: %v", val)
+	}
+}
+
+// holder is comparable by type, but panics on == holding a slice.
+type holder struct {
+	val interface{}
+}
+
+func TestLRU_CompareAndSwap(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup interface{}
+		old   interface{}
+		new   interface{}
+		want  bool
+	}{
+		{"not exist", nil, nil, 1, false},
+		{"equal", "v1", "v1", "v2", true},
+		{"not equal", "v2", "v1", "v3", false},
+		{"different type", "v2", []byte("v2"), "v3", false},
+		{"uncomparable", []byte("v2"), []byte("v2"), []byte("v3"), false},
+		{"uncomparable field", holder{[]byte("v2")}, holder{[]byte("v2")}, "v3", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLRU(WithCapacity(8192))
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if tt.setup != nil {
+				l.Set("key", tt.setup)
+			}
+			if got := l.CompareAndSwap("key", tt.old, tt.new); got != tt.want {
+				t.Errorf("CompareAndSwap() = %v, want %v", got, tt.want)
+			}
+			want := tt.setup
+			if tt.want {
+				want = tt.new
+			}
+			if val, _ := l.Get("key"); !reflect.DeepEqual(val, want) {
+				t.Errorf("CompareAndSwap() left %v, want %v", val, want)
+			}
+		})
+	}
+}
+
+func TestLRU_Compute(t *testing.T) {
+	l, err := NewLRU(WithCapacity(8192))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	incr := func(old interface{}, exists bool) (interface{}, bool) {
+		if !exists {
+			return 1, true
+		}
+		return old.(int) + 1, true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				l.Compute("counter", incr)
+			}
+		}()
+	}
+	wg.Wait()
+	if val, _ := l.Get("counter"); val != 8000 {
+		t.Fatalf("Compute counter expected: 8000, got: %v", val)
+	}
+
+	val, ok := l.Compute("counter", func(old interface{}, exists bool) (interface{}, bool) {
+		return nil, false
+	})
+	if ok || val != nil || l.Exists("counter") {
+		t.Fatalf("Compute expected key deleted, got: %v, %v", val, ok)
+	}
+}
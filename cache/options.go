@@ -1,5 +1,10 @@
 package cache
 
+import (
+	"io"
+	"time"
+)
+
 const (
 	maxSegments = 1 << 16
 	maxCapacity = 1 << 30
@@ -8,10 +13,32 @@ const (
 type options struct {
 	concurrency int
 	capacity    int
+
+	traceWriter io.Writer
+	traceRate   float64
+
+	mrcRate float64
+
+	writeQueue    int
+	writeBatch    int
+	writeInterval time.Duration
+	writeRetries  int
+	onWriteError  func(key string, err error)
 }
 
 type Opt func(*options)
 
+func newOptions(opts ...Opt) *options {
+	options := &options{
+		concurrency: 16,
+		capacity:    8192,
+	}
+	for _, each := range opts {
+		each(options)
+	}
+	return options
+}
+
 func WithConcurrency(c int) Opt {
 	return func(o *options) {
 		o.concurrency = c
@@ -23,3 +50,52 @@ func WithCapacity(c int) Opt {
 		o.capacity = c
 	}
 }
+
+// WithTraceRecorder records sampled Get/Set/Delete events into w, so that
+// production access patterns can be replayed offline.
+// Keys are sampled by hash, sampleRate must be in (0, 1].
+func WithTraceRecorder(w io.Writer, sampleRate float64) Opt {
+	return func(o *options) {
+		o.traceWriter = w
+		o.traceRate = sampleRate
+	}
+}
+
+// WithMissRatioCurve estimates the miss ratio the cache would have at other
+// capacities, by tracking reuse distance of keys sampled by hash.
+// sampleRate must be in (0, 1], 0.001~0.01 is usually accurate enough.
+// Only Gets count as references, writes only refresh recency of keys.
+// At most 8192 sampled keys are tracked, the sample rate is lowered once
+// more keys are sampled, so memory stays bounded.
+func WithMissRatioCurve(sampleRate float64) Opt {
+	return func(o *options) {
+		o.mrcRate = sampleRate
+	}
+}
+
+// WithWriteBehind makes the cache built by NewWriteCache write its store
+// asynchronously. Writes of the same key are coalesced, up to queue keys
+// may wait for flushing, which happens every interval or once batch keys
+// are waiting.
+func WithWriteBehind(queue, batch int, interval time.Duration) Opt {
+	return func(o *options) {
+		o.writeQueue = queue
+		o.writeBatch = batch
+		o.writeInterval = interval
+	}
+}
+
+// WithWriteRetries sets how many times a failed store write is retried.
+func WithWriteRetries(n int) Opt {
+	return func(o *options) {
+		o.writeRetries = n
+	}
+}
+
+// WithWriteErrorHandler sets fn to be called when a store write fails
+// finally. Failed keys are removed from the cache.
+func WithWriteErrorHandler(fn func(key string, err error)) Opt {
+	return func(o *options) {
+		o.onWriteError = fn
+	}
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// shardsBuckets is how many points the curve has, covering up to
+	// shardsBuckets/shardsBucketsPerCap times of the cache capacity.
+	shardsBuckets       = 128
+	shardsBucketsPerCap = 32
+	shardsMinTree       = 1024
+	// shardsMaxKeys bounds the sampled keys tracked, by lowering the
+	// sample rate once more are sampled
+	shardsMaxKeys = 8192
+)
+
+// CurvePoint is the estimated miss ratio of a LRU cache holding Capacity entries.
+type CurvePoint struct {
+	Capacity  int
+	MissRatio float64
+}
+
+// shards estimates miss ratio curve with spatially hashed sampling
+// ref: https://www.usenix.org/system/files/conference/fast15/fast15-paper-waldspurger.pdf
+//
+// Reuse distances of sampled keys are counted with a fenwick tree over
+// logical access time, in which each key marks only its latest access.
+// Only reads are references counted in the curve, writes only refresh the
+// recency of keys.
+// It is the fixed-size variant, at most shardsMaxKeys keys are tracked,
+// and keys of the largest hashes are dropped, lowering threshold and rate.
+type shards struct {
+	threshold uint64 // accessed atomically
+	mtx       sync.Mutex
+	rate      float64
+
+	last map[uint64]sampledKey
+	tree []int
+	now  int
+
+	width int
+	hist  []uint64
+	total uint64
+}
+
+func newShards(capacity int, rate float64) *shards {
+	width := capacity / shardsBucketsPerCap
+	if width < 1 {
+		width = 1
+	}
+	return &shards{
+		threshold: uint64(rate * (math.MaxUint32 + 1)),
+		rate:      rate,
+		last:      make(map[uint64]sampledKey),
+		tree:      make([]int, shardsMinTree+1),
+		width:     width,
+		hist:      make([]uint64, shardsBuckets),
+	}
+}
+
+type sampledKey struct {
+	time   int
+	sample uint32
+}
+
+func (s *shards) sampled(h uint32) bool {
+	return uint64(mix32(h)) < atomic.LoadUint64(&s.threshold)
+}
+
+// access records an access of key hashed h, and the reuse distance of it
+// if it is a reference.
+func (s *shards) access(key uint64, h uint32, ref bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// threshold may be lowered since sampled
+	sample := mix32(h)
+	if uint64(sample) >= atomic.LoadUint64(&s.threshold) {
+		return
+	}
+	if s.now+1 >= len(s.tree) {
+		s.compact()
+	}
+
+	if ref {
+		s.total++
+	}
+	if k, ok := s.last[key]; ok {
+		if ref {
+			distinct := s.sum(s.now) - s.sum(k.time+1)
+			if b := int(float64(distinct)/s.rate) / s.width; b < len(s.hist) {
+				s.hist[b]++
+			}
+		}
+		s.add(k.time, -1)
+	}
+	s.add(s.now, 1)
+	s.last[key] = sampledKey{s.now, sample}
+	s.now++
+
+	if len(s.last) > shardsMaxKeys {
+		s.shrink()
+	}
+}
+
+// remove forgets key, so the next reference is a cold miss.
+func (s *shards) remove(key uint64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if k, ok := s.last[key]; ok {
+		s.add(k.time, -1)
+		delete(s.last, key)
+	}
+}
+
+// shrink lowers threshold to keep 3/4 of shardsMaxKeys keys of the
+// smallest hashes, so it runs once every shardsMaxKeys/4 new keys at most.
+// Counts taken at higher rates are kept, as the curve is a ratio of them.
+func (s *shards) shrink() {
+	samples := make([]uint32, 0, len(s.last))
+	for _, k := range s.last {
+		samples = append(samples, k.sample)
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	threshold := samples[shardsMaxKeys*3/4]
+	for key, k := range s.last {
+		if k.sample >= threshold {
+			s.add(k.time, -1)
+			delete(s.last, key)
+		}
+	}
+	atomic.StoreUint64(&s.threshold, uint64(threshold))
+	s.rate = float64(threshold) / (math.MaxUint32 + 1)
+}
+
+// curve returns miss ratios at every bucket boundary.
+func (s *shards) curve() []CurvePoint {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.total == 0 {
+		return nil
+	}
+	points := make([]CurvePoint, len(s.hist))
+	hits := uint64(0)
+	for i, each := range s.hist {
+		hits += each
+		points[i] = CurvePoint{
+			Capacity:  (i + 1) * s.width,
+			MissRatio: 1 - float64(hits)/float64(s.total),
+		}
+	}
+	return points
+}
+
+// compact renumbers the access time of tracked keys from zero,
+// and grows the tree if it is more than half used by live keys.
+func (s *shards) compact() {
+	type access struct {
+		key uint64
+		sampledKey
+	}
+	live := make([]access, 0, len(s.last))
+	for key, k := range s.last {
+		live = append(live, access{key, k})
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].time < live[j].time })
+
+	size := len(s.tree) - 1
+	if 2*len(live) > size {
+		size *= 2
+	}
+	s.tree = make([]int, size+1)
+	for i, each := range live {
+		s.last[each.key] = sampledKey{i, each.sample}
+		s.add(i, 1)
+	}
+	s.now = len(live)
+}
+
+// add and sum implement fenwick tree operations on zero-based time.
+func (s *shards) add(t, delta int) {
+	for i := t + 1; i < len(s.tree); i += i & -i {
+		s.tree[i] += delta
+	}
+}
+
+// sum returns the count of marks on time [0, t).
+func (s *shards) sum(t int) int {
+	total := 0
+	for i := t; i > 0; i -= i & -i {
+		total += s.tree[i]
+	}
+	return total
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestLRU_MissRatioCurve(t *testing.T) {
+	l, err := NewLRU(WithCapacity(1024), WithMissRatioCurve(1))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if got := l.MissRatioCurve(); got != nil {
+		t.Fatalf("MissRatioCurve expected nil before access, got: %v", got)
+	}
+
+	// loop over 1000 keys, every reuse distance is 999
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 1000; i++ {
+			l.Get(strconv.Itoa(i))
+			l.Set(strconv.Itoa(i), i)
+		}
+	}
+
+	curve := l.MissRatioCurve()
+	if len(curve) != shardsBuckets {
+		t.Fatalf("MissRatioCurve expected %v points, got: %v", shardsBuckets, len(curve))
+	}
+	for _, each := range curve {
+		want := 1.0 // every Get misses
+		if each.Capacity >= 1000 {
+			want = 0.1 // only the first round of Get misses
+		}
+		if math.Abs(each.MissRatio-want) > 0.001 {
+			t.Fatalf("MissRatioCurve at %v expected: %v, got: %v", each.Capacity, want, each.MissRatio)
+		}
+	}
+	if got := l.Stats().MissRatioCurve; len(got) != len(curve) {
+		t.Fatalf("Stats curve expected %v points, got: %v", len(curve), len(got))
+	}
+}
+
+func TestLRU_MissRatioCurveSampled(t *testing.T) {
+	l, err := NewLRU(WithCapacity(4096), WithMissRatioCurve(0.1))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// uniform access, hit ratio of LRU is capacity/keys
+	keys := 4096
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200000; i++ {
+		l.Get(strconv.Itoa(r.Intn(keys)))
+	}
+
+	threshold := 0.1
+	for _, each := range l.MissRatioCurve() {
+		if each.Capacity > keys {
+			break
+		}
+		want := 1 - float64(each.Capacity)/float64(keys)
+		if math.Abs(each.MissRatio-want) > threshold {
+			t.Fatalf("MissRatioCurve at %v expected: %v, got: %v", each.Capacity, want, each.MissRatio)
+		}
+	}
+}
+
+func TestLRU_MissRatioCurveBounded(t *testing.T) {
+	l, err := NewLRU(WithCapacity(4096), WithMissRatioCurve(1))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// uniform access over 4 times more keys than tracked
+	keys := 4 * shardsMaxKeys
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20*keys; i++ {
+		l.Get(strconv.Itoa(r.Intn(keys)))
+	}
+	if len(l.shards.last) > shardsMaxKeys || l.shards.rate >= 1 {
+		t.Fatalf("shards expected at most %v keys at lower rate, got: %v at %v", shardsMaxKeys, len(l.shards.last), l.shards.rate)
+	}
+
+	threshold := 0.1
+	for _, each := range l.MissRatioCurve() {
+		want := 1 - float64(each.Capacity)/float64(keys)
+		if math.Abs(each.MissRatio-want) > threshold {
+			t.Fatalf("MissRatioCurve at %v expected: %v, got: %v", each.Capacity, want, each.MissRatio)
+		}
+	}
+}
+
+func TestLRU_MissRatioCurveRate(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.1} {
+		if _, err := NewLRU(WithMissRatioCurve(rate)); err == nil {
+			t.Fatalf("MissRatioCurve rate:%v expected err", rate)
+		}
+	}
+}
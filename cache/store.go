@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"errors"
+)
+
+// Store is a key-value storage the cache keeps its entries in.
+type Store interface {
+	// Load reads value under the key.
+	// If key not exist, <nil, false, nil> will be return
+	Load(key string) (val interface{}, ok bool, err error)
+
+	// Store saves value under the key.
+	Store(key string, val interface{}) error
+
+	// Delete removes the key, deleting nonexistent key is not an error.
+	Delete(key string) error
+}
+
+// Codec converts values to and from bytes, for stores saving bytes.
+type Codec interface {
+	Marshal(val interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// BytesCodec is a Codec for []byte and string values, decoded as []byte.
+type BytesCodec struct{}
+
+func (BytesCodec) Marshal(val interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.New("bytes codec unsupported value")
+	}
+}
+
+func (BytesCodec) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
+}
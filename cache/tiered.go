@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+var _ edge.Cache = &tiered{}
+
+type evictNotifier interface {
+	OnEvict(fn func(key string, val interface{}))
+}
+
+type exister interface {
+	Exists(key string) bool
+}
+
+// tiered keeps hot entries in l1, and entries evicted from l1 in l2.
+// An entry lives in one tier at a time, l2 hits are promoted back into l1.
+// Errors of l2 are counted in expvar "cache.tiered.error", and the entry
+// is treated as nonexistent.
+// Writes and l1 misses hold the key lock of their key. An entry evicted from
+// l1 is kept in demoted until it is stored into l2 under its key lock, so
+// it is found meanwhile. l1 hits take no lock.
+type tiered struct {
+	l1    edge.Cache
+	l2    Store
+	locks [writeLocks]sync.Mutex
+
+	mtx     sync.Mutex
+	demoted map[string]*demotion
+}
+
+type demotion struct {
+	val     interface{}
+	storing bool
+}
+
+// NewTiered builds a two-tier cache, l1 must notify eviction like the
+// cache built by NewLRU does. Each l1 can back only one tiered cache.
+func NewTiered(l1 edge.Cache, l2 Store) (*tiered, error) {
+	notifier, ok := l1.(evictNotifier)
+	switch {
+	case l1 == nil || l2 == nil:
+		return nil, errors.New("tiered cache tier invalid")
+	case !ok:
+		return nil, errors.New("tiered cache l1 not notify eviction")
+	}
+
+	t := &tiered{
+		l1:      l1,
+		l2:      l2,
+		demoted: make(map[string]*demotion),
+	}
+	notifier.OnEvict(t.demote)
+	return t, nil
+}
+
+func (t *tiered) Set(key string, val interface{}) interface{} {
+	defer t.settleAll()
+
+	mtx := t.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	// taken before the l1 write, which may evict val right away
+	demoted, ok := t.undemote(key)
+	old := t.l1.Set(key, val)
+	switch {
+	case old != nil:
+	case ok:
+		old = demoted
+		t.remove(key)
+	default:
+		old = t.take(key)
+	}
+	return old
+}
+
+func (t *tiered) Get(key string) (value interface{}, ok bool) {
+	if value, ok = t.l1.Get(key); ok {
+		return value, ok
+	}
+	defer t.settleAll()
+
+	mtx := t.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+	// promoted or set while waiting
+	if value, ok = t.l1.Get(key); ok {
+		return value, ok
+	}
+	if value, ok = t.undemote(key); !ok {
+		var err error
+		if value, ok, err = t.l2.Load(key); err != nil {
+			m.TieredError.Add(1)
+			return nil, false
+		}
+	}
+	if ok {
+		m.TieredPromote.Add(1)
+		t.l1.Set(key, value)
+		t.remove(key)
+	}
+	return value, ok
+}
+
+func (t *tiered) Delete(key string) (present bool) {
+	mtx := t.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	present = t.l1.Delete(key)
+	if _, ok := t.undemote(key); ok {
+		present = true
+	}
+	if !present {
+		present = t.inL2(key)
+	}
+	t.remove(key)
+	return present
+}
+
+func (t *tiered) Exists(key string) bool {
+	if t.l1.Exists(key) {
+		return true
+	}
+
+	mtx := t.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	t.mtx.Lock()
+	_, ok := t.demoted[key]
+	t.mtx.Unlock()
+	return ok || t.l1.Exists(key) || t.inL2(key)
+}
+
+// Cap returns capacity of the memory tier.
+func (t *tiered) Cap() int {
+	return t.l1.Cap()
+}
+
+// Len returns how many keys are stored in the memory tier.
+func (t *tiered) Len() int {
+	return t.l1.Len()
+}
+
+// Close closes both tiers if they are io.Closer.
+func (t *tiered) Close() error {
+	t.settleAll()
+
+	var err error
+	for _, each := range []interface{}{t.l1, t.l2} {
+		if c, ok := each.(io.Closer); ok {
+			if e := c.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// demote runs under the lock of the l1 segment evicting key, so it only
+// records the entry, which is stored into l2 by settleAll later.
+func (t *tiered) demote(key string, val interface{}) {
+	m.TieredDemote.Add(1)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	t.demoted[key] = &demotion{val: val}
+}
+
+// undemote removes key from demoted, returning the value removed.
+func (t *tiered) undemote(key string) (interface{}, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	d, ok := t.demoted[key]
+	if !ok {
+		return nil, false
+	}
+	delete(t.demoted, key)
+	return d.val, true
+}
+
+// settleAll stores entries demoted into l2. It is called by operations
+// writing l1, after their key lock is released.
+func (t *tiered) settleAll() {
+	t.mtx.Lock()
+	if len(t.demoted) == 0 {
+		t.mtx.Unlock()
+		return
+	}
+	keys := make([]string, 0, len(t.demoted))
+	for key := range t.demoted {
+		keys = append(keys, key)
+	}
+	t.mtx.Unlock()
+
+	for _, key := range keys {
+		t.settle(key)
+	}
+}
+
+// settle stores key demoted into l2, unless another settle is storing it.
+// The entry stays in demoted until stored, or taken back by operations of
+// key, which wait for the store with the key lock.
+func (t *tiered) settle(key string) {
+	t.mtx.Lock()
+	d, ok := t.demoted[key]
+	if !ok || d.storing {
+		t.mtx.Unlock()
+		return
+	}
+	d.storing = true
+	t.mtx.Unlock()
+
+	mtx := t.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	t.mtx.Lock()
+	current := t.demoted[key] == d
+	t.mtx.Unlock()
+	if !current {
+		return
+	}
+	if err := t.l2.Store(key, d.val); err != nil {
+		m.TieredError.Add(1)
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	// a newer value may be demoted meanwhile
+	if t.demoted[key] == d {
+		delete(t.demoted, key)
+	}
+}
+
+// take removes key from l2, returning the value removed.
+func (t *tiered) take(key string) interface{} {
+	if e, ok := t.l2.(exister); ok && !e.Exists(key) {
+		return nil
+	}
+	val, ok, err := t.l2.Load(key)
+	if err != nil {
+		m.TieredError.Add(1)
+	}
+	if ok {
+		t.remove(key)
+	}
+	return val
+}
+
+func (t *tiered) remove(key string) {
+	if e, ok := t.l2.(exister); ok && !e.Exists(key) {
+		return
+	}
+	if err := t.l2.Delete(key); err != nil {
+		m.TieredError.Add(1)
+	}
+}
+
+func (t *tiered) inL2(key string) bool {
+	if e, ok := t.l2.(exister); ok {
+		return e.Exists(key)
+	}
+	_, ok, err := t.l2.Load(key)
+	if err != nil {
+		m.TieredError.Add(1)
+	}
+	return ok
+}
+
+func (t *tiered) lockFor(key string) *sync.Mutex {
+	return &t.locks[hashOf(key)%writeLocks]
+}
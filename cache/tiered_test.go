@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "l2.log")
+	s, err := NewDiskStore(path, BytesCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		if err := s.Store(strconv.Itoa(i), []byte("value-"+strconv.Itoa(i))); err != nil {
+			t.Fatalf("Store err: %v", err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if err := s.Delete(strconv.Itoa(i)); err != nil {
+			t.Fatalf("Delete err: %v", err)
+		}
+	}
+	if err := s.Store("99", "overwrite"); err != nil {
+		t.Fatalf("Store err: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close err: %v", err)
+	}
+
+	// torn tail of crash is dropped on open
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.Write([]byte{1, 2, 3, 4, 5, 6})
+	f.Close()
+
+	s, err = NewDiskStore(path, BytesCodec{})
+	if err != nil {
+		t.Fatalf("reopen err: %v", err)
+	}
+	defer s.Close()
+	check := func() {
+		if s.Len() != 50 {
+			t.Fatalf("Len expected: 50, got: %v", s.Len())
+		}
+		for i := 0; i < 99; i++ {
+			val, ok, err := s.Load(strconv.Itoa(i))
+			if err != nil {
+				t.Fatalf("Load err: %v", err)
+			}
+			if ok != (i >= 50) {
+				t.Fatalf("Load %v expected exist: %v, got: %v", i, i >= 50, ok)
+			}
+			if ok && !bytes.Equal(val.([]byte), []byte("value-"+strconv.Itoa(i))) {
+				t.Fatalf("Load %v got: %s", i, val)
+			}
+		}
+		if val, _, _ := s.Load("99"); string(val.([]byte)) != "overwrite" {
+			t.Fatalf("Load 99 expected overwrite, got: %s", val)
+		}
+	}
+	check()
+
+	before := s.log.Size()
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact err: %v", err)
+	}
+	if s.log.Size() >= before {
+		t.Fatalf("Compact expected size < %v, got: %v", before, s.log.Size())
+	}
+	check()
+	if err := s.Store("100", "after compact"); err != nil {
+		t.Fatalf("Store err: %v", err)
+	}
+	if val, ok, _ := s.Load("100"); !ok || string(val.([]byte)) != "after compact" {
+		t.Fatalf("Load after compact got: %s", val)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	l1, _ := NewLRU(WithCapacity(128), WithConcurrency(1))
+	l2, err := NewDiskStore(filepath.Join(t.TempDir(), "l2.log"), BytesCodec{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c, err := NewTiered(l1, l2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 1024; i++ {
+		c.Set(strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	if l1.Len() != 128 || l2.Len() != 1024-128 {
+		t.Fatalf("tiers expected 128, 896 entries, got: %v, %v", l1.Len(), l2.Len())
+	}
+
+	// l2 hit is promoted into l1
+	if val, ok := c.Get("0"); !ok || string(val.([]byte)) != "0" {
+		t.Fatalf("Get 0 expected 0, got: %v, %v", val, ok)
+	}
+	if !l1.Exists("0") || l2.Exists("0") {
+		t.Fatalf("Get 0 expected promoted")
+	}
+	if l1.Len() != 128 || l2.Len() != 1024-128 {
+		t.Fatalf("tiers expected 128, 896 entries, got: %v, %v", l1.Len(), l2.Len())
+	}
+
+	if old := c.Set("1", []byte("new")); string(old.([]byte)) != "1" {
+		t.Fatalf("Set 1 expected old value 1, got: %v", old)
+	}
+	if val, _ := c.Get("1"); string(val.([]byte)) != "new" {
+		t.Fatalf("Get 1 expected new, got: %v", val)
+	}
+
+	if !c.Exists("2") || !c.Delete("2") || c.Exists("2") || c.Delete("2") {
+		t.Fatalf("Delete 2 from l2 failed")
+	}
+	if !c.Delete("1") || c.Exists("1") {
+		t.Fatalf("Delete 1 from l1 failed")
+	}
+	if _, ok := c.Get("1024"); ok {
+		t.Fatalf("Get 1024 should not exist")
+	}
+}
+
+func TestTiered_Concurrent(t *testing.T) {
+	l1, _ := NewLRU(WithCapacity(16), WithConcurrency(1))
+	c, err := NewTiered(l1, newMemStore())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// each goroutine owns its keys, while evicting keys of others
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			last := map[string]int{}
+			for i := 0; i < 2000; i++ {
+				key := strconv.Itoa(g) + "-" + strconv.Itoa(i%8)
+				if i%5 == 4 {
+					c.Delete(key)
+					delete(last, key)
+				} else {
+					c.Set(key, i)
+					last[key] = i
+				}
+				want, exist := last[key]
+				if val, ok := c.Get(key); ok != exist || (ok && val != want) {
+					t.Errorf("Get(%v) = %v, %v, want %v, %v", key, val, ok, want, exist)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestTiered_SlowStore(t *testing.T) {
+	l1, _ := NewLRU(WithCapacity(1), WithConcurrency(1))
+	l2 := &blockStore{
+		memStore: newMemStore(),
+		key:      "a",
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	c, err := NewTiered(l1, l2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	c.Set("a", 1)
+	go c.Set("b", 2)
+	<-l2.entered
+
+	// keys other than a are not blocked by storing a into l2
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Set("c", 3)
+		if val, ok := c.Get("b"); !ok || val != 2 {
+			t.Errorf("Get b expected 2, got: %v, %v", val, ok)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("operations of other keys blocked by storing a")
+	}
+
+	close(l2.release)
+	if val, ok := c.Get("a"); !ok || val != 1 {
+		t.Fatalf("Get a expected 1, got: %v, %v", val, ok)
+	}
+	if val, ok := c.Get("c"); !ok || val != 3 {
+		t.Fatalf("Get c expected 3, got: %v, %v", val, ok)
+	}
+}
+
+func TestNewTiered(t *testing.T) {
+	l1, _ := NewLRU()
+	if _, err := NewTiered(l1, nil); err == nil {
+		t.Fatalf("NewTiered expected err for nil l2")
+	}
+	l2, _ := NewDiskStore(filepath.Join(t.TempDir(), "l2.log"), BytesCodec{})
+	defer l2.Close()
+	inner, _ := NewTiered(l1, l2)
+	if _, err := NewTiered(inner, l2); err == nil {
+		t.Fatalf("NewTiered expected err for l1 not notify eviction")
+	}
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	traceBuffer        = 4096
+	traceFlushInterval = time.Second
+)
+
+type traceOp byte
+
+const (
+	traceGet    traceOp = 'G'
+	traceSet    traceOp = 'S'
+	traceDelete traceOp = 'D'
+)
+
+type traceEvent struct {
+	ts   int64
+	op   traceOp
+	key  uint64
+	size int
+	hit  bool
+}
+
+// tracer writes sampled access events as lines:
+//
+//	<unix nano> <op> <fnv64a(key) in hex> <value size> <h|m>
+//
+// op is one of G(et), S(et), D(elete). For Set a hit means an old value was
+// replaced, for Delete a hit means the key was present.
+// Recording never blocks the caller, events are dropped if the buffer is full.
+type tracer struct {
+	w         *bufio.Writer
+	threshold uint64
+	events    chan traceEvent
+	done      chan struct{}
+	stopped   chan struct{}
+	once      sync.Once
+	err       error
+}
+
+func newTracer(w io.Writer, rate float64) *tracer {
+	t := &tracer{
+		w:         bufio.NewWriter(w),
+		threshold: uint64(rate * (math.MaxUint32 + 1)),
+		events:    make(chan traceEvent, traceBuffer),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// sampled reports whether the key with hash h should be recorded.
+// Sampling is spatial, so every access of a sampled key is recorded.
+func (t *tracer) sampled(h uint32) bool {
+	return uint64(mix32(h)) < t.threshold
+}
+
+func (t *tracer) record(op traceOp, key uint64, val interface{}, hit bool) {
+	e := traceEvent{
+		ts:   time.Now().UnixNano(),
+		op:   op,
+		key:  key,
+		size: sizeOf(val),
+		hit:  hit,
+	}
+
+	select {
+	case t.events <- e:
+	default:
+		m.TraceDrop.Add(1)
+	}
+}
+
+func (t *tracer) loop() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	buf := make([]byte, 0, 64)
+	for {
+		select {
+		case e := <-t.events:
+			buf = t.write(buf, e)
+		case <-ticker.C:
+			t.flush()
+		case <-t.done:
+			for {
+				select {
+				case e := <-t.events:
+					buf = t.write(buf, e)
+				default:
+					t.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *tracer) write(buf []byte, e traceEvent) []byte {
+	buf = strconv.AppendInt(buf[:0], e.ts, 10)
+	buf = append(buf, ' ', byte(e.op), ' ')
+	buf = strconv.AppendUint(buf, e.key, 16)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(e.size), 10)
+	if e.hit {
+		buf = append(buf, " h\n"...)
+	} else {
+		buf = append(buf, " m\n"...)
+	}
+	if _, err := t.w.Write(buf); err != nil && t.err == nil {
+		t.err = err
+	}
+	return buf
+}
+
+func (t *tracer) flush() {
+	if err := t.w.Flush(); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Close writes out buffered events and stops recording.
+// It returns the first error met while writing.
+func (t *tracer) Close() error {
+	t.once.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+	return t.err
+}
+
+// mix32 is the murmur3 finalizer, it decorrelates sampling from the
+// hash bits already used for segment selection.
+func mix32(h uint32) uint32 {
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+func sizeOf(val interface{}) int {
+	switch v := val.(type) {
+	case []byte:
+		return len(v)
+	case string:
+		return len(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLRU_TraceRecorder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l, err := NewLRU(WithCapacity(128), WithTraceRecorder(buf, 1))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	l.Set("key", []byte("value"))
+	l.Set("key", []byte("val"))
+	l.Get("key")
+	l.Get("missing")
+	l.Delete("key")
+	l.Delete("key")
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close err: %v", err)
+	}
+
+	want := []struct {
+		op   string
+		size string
+		hit  string
+	}{
+		{"S", "5", "m"},
+		{"S", "3", "h"},
+		{"G", "3", "h"},
+		{"G", "0", "m"},
+		{"D", "0", "h"},
+		{"D", "0", "m"},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("trace expected %v lines, got: %q", len(want), lines)
+	}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			t.Fatalf("trace line malformed: %q", line)
+		}
+		if fields[1] != want[i].op || fields[3] != want[i].size || fields[4] != want[i].hit {
+			t.Errorf("trace line %v = %q, want op:%v size:%v hit:%v", i, line, want[i].op, want[i].size, want[i].hit)
+		}
+	}
+	if fields := strings.Fields(lines[0]); fields[2] != strings.Fields(lines[4])[2] {
+		t.Errorf("trace key hash expected stable, got: %v, %v", lines[0], lines[4])
+	}
+}
+
+func TestLRU_TraceSampleRate(t *testing.T) {
+	tests := []struct {
+		rate    float64
+		wantErr bool
+	}{
+		{rate: 0, wantErr: true},
+		{rate: -0.1, wantErr: true},
+		{rate: 1.1, wantErr: true},
+		{rate: 0.01, wantErr: false},
+		{rate: 1, wantErr: false},
+	}
+
+	for _, tc := range tests {
+		l, err := NewLRU(WithTraceRecorder(&bytes.Buffer{}, tc.rate))
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("TraceRecorder rate:%v expected err: %v, got:%v", tc.rate, tc.wantErr, err)
+		}
+		if err == nil {
+			_ = l.Close()
+		}
+	}
+
+	// sampling is by key, so each key is set once to sample n times
+	// independently with p
+	const n, p = 10000, 0.1
+	buf := &bytes.Buffer{}
+	l, _ := NewLRU(WithTraceRecorder(buf, p))
+	for i := 0; i < n; i++ {
+		l.Set("key-"+strconv.Itoa(i), i)
+	}
+	_ = l.Close()
+	got := float64(strings.Count(buf.String(), "\n"))
+	mean, sigma := n*p, math.Sqrt(n*p*(1-p))
+	if math.Abs(got-mean) > 5*sigma {
+		t.Fatalf("TraceRecorder sampled lines expected %v±%.0f, got: %v", mean, 5*sigma, got)
+	}
+}
@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+const (
+	writeLocks   = 256
+	retryBackoff = 10 * time.Millisecond
+)
+
+var _ edge.Cache = &writeCache{}
+
+// writeCache is the single write path in front of a store.
+// Reads miss in the LRU are loaded from store. Writes go to both the LRU
+// and store, synchronously in write-through mode, or queued and flushed
+// in batches in write-behind mode.
+// Writes of a key are serialized, so the LRU and store see them in the same order.
+type writeCache struct {
+	lru     *cache
+	store   Store
+	retries int
+	onError func(key string, err error)
+	locks   [writeLocks]sync.Mutex
+
+	behind *writeBehind
+}
+
+// NewWriteCache builds a LRU cache by opts over store, running in
+// write-through mode unless WithWriteBehind is set.
+func NewWriteCache(store Store, opts ...Opt) (*writeCache, error) {
+	options := newOptions(opts...)
+	switch {
+	case store == nil:
+		return nil, errors.New("write cache store invalid")
+	case options.writeRetries < 0:
+		return nil, errors.New("write cache retries invalid")
+	case options.writeQueue < 0:
+		return nil, errors.New("write cache queue invalid")
+	case options.writeQueue > 0 && (options.writeBatch <= 0 || options.writeInterval <= 0):
+		return nil, errors.New("write cache batch invalid")
+	}
+
+	l, err := NewLRU(opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := &writeCache{
+		lru:     l,
+		store:   store,
+		retries: options.writeRetries,
+		onError: options.onWriteError,
+	}
+	if options.writeQueue > 0 {
+		c.behind = newWriteBehind(c, options.writeQueue, options.writeBatch, options.writeInterval)
+	}
+	return c, nil
+}
+
+func (c *writeCache) Set(key string, val interface{}) interface{} {
+	mtx := c.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if c.behind != nil {
+		// queued before the LRU is set, so a failed flush of an older
+		// write sees it and keeps the value
+		if err := c.behind.enqueue(key, write{val: val}); err == nil {
+			return c.lru.Set(key, val)
+		}
+	} else if err := c.write(key, write{val: val}); err == nil {
+		return c.lru.Set(key, val)
+	}
+	old, _ := c.lru.Get(key)
+	c.lru.Delete(key)
+	return old
+}
+
+func (c *writeCache) Get(key string) (value interface{}, ok bool) {
+	if value, ok = c.lru.Get(key); ok {
+		return value, ok
+	}
+
+	mtx := c.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	value, ok, err := c.load(key)
+	if err != nil {
+		m.StoreError.Add(1)
+		return nil, false
+	}
+	if ok {
+		value, _ = c.lru.SetIfAbsent(key, value)
+	}
+	return value, ok
+}
+
+// Delete removes the key in cache and store.
+// It returns whether the key was in cache.
+func (c *writeCache) Delete(key string) (present bool) {
+	present, _ = c.DeleteErr(key)
+	return present
+}
+
+// DeleteErr is Delete returning the error of store, after which the key
+// may be loaded from store again. In write-behind mode, it only fails
+// once closed, errors of queued deletes go to WithWriteErrorHandler.
+func (c *writeCache) DeleteErr(key string) (present bool, err error) {
+	mtx := c.lockFor(key)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	if c.behind != nil {
+		err = c.behind.enqueue(key, write{delete: true})
+	} else {
+		err = c.write(key, write{delete: true})
+	}
+	return c.lru.Delete(key), err
+}
+
+func (c *writeCache) Exists(key string) bool {
+	if c.lru.Exists(key) {
+		return true
+	}
+	_, ok, err := c.load(key)
+	if err != nil {
+		m.StoreError.Add(1)
+	}
+	return ok
+}
+
+func (c *writeCache) Cap() int {
+	return c.lru.Cap()
+}
+
+func (c *writeCache) Len() int {
+	return c.lru.Len()
+}
+
+// Flush writes all queued writes into store, returning the first error.
+// It is a no-op in write-through mode.
+func (c *writeCache) Flush() error {
+	if c.behind == nil {
+		return nil
+	}
+	return c.behind.flush()
+}
+
+// Close flushes queued writes and stops background work.
+// Writes after Close go to store synchronously.
+func (c *writeCache) Close() error {
+	var err error
+	if c.behind != nil {
+		err = c.behind.close()
+	}
+	if e := c.lru.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// load reads key from the writes waiting for flush first, then store.
+func (c *writeCache) load(key string) (interface{}, bool, error) {
+	if c.behind != nil {
+		if w, ok := c.behind.lookup(key); ok {
+			return w.val, !w.delete, nil
+		}
+	}
+	return c.store.Load(key)
+}
+
+// write applies w into store with retries. If it fails finally, callers
+// remove key from the LRU, as its value may differ from store.
+func (c *writeCache) write(key string, w write) error {
+	var err error
+	for i := 0; i <= c.retries; i++ {
+		if i > 0 {
+			time.Sleep(retryBackoff << uint(i-1))
+		}
+		if w.delete {
+			err = c.store.Delete(key)
+		} else {
+			err = c.store.Store(key, w.val)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+
+	m.StoreError.Add(1)
+	if c.onError != nil {
+		c.onError(key, err)
+	}
+	return err
+}
+
+func (c *writeCache) lockFor(key string) *sync.Mutex {
+	return &c.locks[hashOf(key)%writeLocks]
+}
+
+type write struct {
+	val    interface{}
+	delete bool
+}
+
+// writeBehind queues the latest write of each key, and flushes them in
+// batches from a background goroutine.
+type writeBehind struct {
+	c        *writeCache
+	queue    int
+	batch    int
+	interval time.Duration
+
+	mtx      sync.Mutex
+	notFull  *sync.Cond
+	pending  map[string]write
+	order    []string
+	inflight map[string]write
+	closed   bool
+
+	flushMtx sync.Mutex
+	kick     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	drained  chan struct{}
+}
+
+func newWriteBehind(c *writeCache, queue, batch int, interval time.Duration) *writeBehind {
+	w := &writeBehind{
+		c:        c,
+		queue:    queue,
+		batch:    batch,
+		interval: interval,
+		pending:  make(map[string]write),
+		inflight: make(map[string]write),
+		kick:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mtx)
+	go w.loop()
+	return w
+}
+
+// enqueue coalesces w with the write of key waiting for flush,
+// it blocks while the queue is full. Once closed, it writes into store
+// synchronously after the final flush, returning the error.
+func (w *writeBehind) enqueue(key string, each write) error {
+	w.mtx.Lock()
+	_, queued := w.pending[key]
+	for !queued && !w.closed && len(w.pending) >= w.queue {
+		w.kickFlush()
+		w.notFull.Wait()
+	}
+	// written after the final flush, which may hold an older write of key
+	if w.closed {
+		w.mtx.Unlock()
+		<-w.drained
+		return w.c.write(key, each)
+	}
+	if !queued {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = each
+	full := len(w.pending) >= w.batch
+	w.mtx.Unlock()
+
+	if full {
+		w.kickFlush()
+	}
+	return nil
+}
+
+func (w *writeBehind) lookup(key string) (write, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if each, ok := w.pending[key]; ok {
+		return each, true
+	}
+	each, ok := w.inflight[key]
+	return each, ok
+}
+
+func (w *writeBehind) kickFlush() {
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (w *writeBehind) loop() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = w.flush()
+		case <-w.kick:
+			_ = w.flushBatch()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// flush writes batches until nothing is pending.
+func (w *writeBehind) flush() error {
+	var err error
+	for {
+		more, e := w.flushOnce()
+		if e != nil && err == nil {
+			err = e
+		}
+		if !more {
+			return err
+		}
+	}
+}
+
+func (w *writeBehind) flushBatch() error {
+	_, err := w.flushOnce()
+	return err
+}
+
+// flushOnce writes at most one batch, returning whether more are pending.
+func (w *writeBehind) flushOnce() (bool, error) {
+	w.flushMtx.Lock()
+	defer w.flushMtx.Unlock()
+
+	w.mtx.Lock()
+	n := len(w.order)
+	if n > w.batch {
+		n = w.batch
+	}
+	keys := w.order[:n:n]
+	writes := make([]write, n)
+	w.order = w.order[n:]
+	for i, key := range keys {
+		writes[i] = w.pending[key]
+		w.inflight[key] = writes[i]
+		delete(w.pending, key)
+	}
+	w.notFull.Broadcast()
+	w.mtx.Unlock()
+
+	var err error
+	for i, key := range keys {
+		if e := w.c.write(key, writes[i]); e != nil {
+			if err == nil {
+				err = e
+			}
+			w.evict(key)
+		}
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, key := range keys {
+		delete(w.inflight, key)
+	}
+	return len(w.order) > 0, err
+}
+
+// evict removes key failed to write from the LRU, unless a newer write of
+// it is queued, whose value the LRU may hold already. The key lock is not
+// taken, as its holder may wait in enqueue for this flush.
+func (w *writeBehind) evict(key string) {
+	w.c.lru.Compute(key, func(old interface{}, exists bool) (interface{}, bool) {
+		w.mtx.Lock()
+		defer w.mtx.Unlock()
+		_, newer := w.pending[key]
+		return old, exists && newer
+	})
+}
+
+func (w *writeBehind) close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mtx.Unlock()
+
+	close(w.done)
+	<-w.stopped
+	err := w.flush()
+	close(w.drained)
+	return err
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	mtx    sync.Mutex
+	data   map[string]interface{}
+	writes int
+	fails  int
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: map[string]interface{}{}}
+}
+
+func (s *memStore) Load(key string) (interface{}, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	val, ok := s.data[key]
+	return val, ok, nil
+}
+
+func (s *memStore) Store(key string, val interface{}) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("store unavailable")
+	}
+	s.writes++
+	s.data[key] = val
+	return nil
+}
+
+func (s *memStore) Delete(key string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("store unavailable")
+	}
+	s.writes++
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memStore) stat() (writes, keys int) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.writes, len(s.data)
+}
+
+func TestWriteCache_WriteThrough(t *testing.T) {
+	store := newMemStore()
+	store.data["loaded"] = "from store"
+	c, err := NewWriteCache(store, WithCapacity(128))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer c.Close()
+
+	c.Set("key", 1)
+	if val, _, _ := store.Load("key"); val != 1 {
+		t.Fatalf("store expected: 1, got: %v", val)
+	}
+	if old := c.Set("key", 2); old != 1 {
+		t.Fatalf("Set expected old: 1, got: %v", old)
+	}
+	if val, ok := c.Get("loaded"); !ok || val != "from store" {
+		t.Fatalf("Get expected loaded from store, got: %v, %v", val, ok)
+	}
+	if !c.lru.Exists("loaded") {
+		t.Fatalf("Get expected loaded into lru")
+	}
+	c.Delete("key")
+	if _, ok, _ := store.Load("key"); ok || c.Exists("key") {
+		t.Fatalf("Delete expected key removed")
+	}
+}
+
+func TestWriteCache_WriteThroughError(t *testing.T) {
+	store := newMemStore()
+	var failed []string
+	c, err := NewWriteCache(store, WithWriteRetries(1), WithWriteErrorHandler(func(key string, err error) {
+		failed = append(failed, key)
+	}))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer c.Close()
+
+	// first failure is retried
+	store.fails = 1
+	c.Set("key", 1)
+	if val, _ := c.Get("key"); val != 1 || len(failed) != 0 {
+		t.Fatalf("Set expected retried, got: %v, failed: %v", val, failed)
+	}
+
+	store.fails = 2
+	c.Set("key", 2)
+	if len(failed) != 1 || failed[0] != "key" {
+		t.Fatalf("Set expected failed key, got: %v", failed)
+	}
+	if val, _ := c.Get("key"); val != 1 {
+		t.Fatalf("Get expected value of store: 1, got: %v", val)
+	}
+
+	store.fails = 2
+	if _, err := c.DeleteErr("key"); err == nil || len(failed) != 2 {
+		t.Fatalf("DeleteErr expected err, got: %v, failed: %v", err, failed)
+	}
+	if present, err := c.DeleteErr("key"); err != nil || present {
+		t.Fatalf("DeleteErr expected deleted, got: %v, %v", present, err)
+	}
+}
+
+func TestWriteCache_WriteBehind(t *testing.T) {
+	store := newMemStore()
+	c, err := NewWriteCache(store, WithCapacity(128), WithWriteBehind(64, 16, time.Hour))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Set("counter", i)
+	}
+	c.Set("deleted", 1)
+	c.Delete("deleted")
+	if writes, _ := store.stat(); writes != 0 {
+		t.Fatalf("store expected no write before flush, got: %v", writes)
+	}
+	if c.Exists("deleted") {
+		t.Fatalf("Exists expected pending delete visible")
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush err: %v", err)
+	}
+	if writes, keys := store.stat(); writes != 2 || keys != 1 {
+		t.Fatalf("store expected coalesced 2 writes 1 key, got: %v, %v", writes, keys)
+	}
+	if val, _, _ := store.Load("counter"); val != 99 {
+		t.Fatalf("store expected: 99, got: %v", val)
+	}
+
+	// batch full kicks flushing before interval
+	for i := 0; i < 1000; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close err: %v", err)
+	}
+	if _, keys := store.stat(); keys != 1001 {
+		t.Fatalf("store expected 1001 keys after close, got: %v", keys)
+	}
+
+	c.Set("after close", 1)
+	if _, ok, _ := store.Load("after close"); !ok {
+		t.Fatalf("Set after close expected written through")
+	}
+}
+
+func TestWriteCache_CloseWhileQueueFull(t *testing.T) {
+	store := newMemStore()
+	c, err := NewWriteCache(store, WithWriteBehind(1, 16, time.Hour))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set(strconv.Itoa(i), i)
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close err: %v", err)
+	}
+	wg.Wait()
+	if _, keys := store.stat(); keys != 8 {
+		t.Fatalf("store expected 8 keys, got: %v", keys)
+	}
+}
+
+// blockStore blocks Store of key until release is closed.
+type blockStore struct {
+	*memStore
+	key     string
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockStore) Store(key string, val interface{}) error {
+	if key == s.key {
+		s.once.Do(func() { close(s.entered) })
+		<-s.release
+	}
+	return s.memStore.Store(key, val)
+}
+
+func TestWriteCache_SetWhileClosing(t *testing.T) {
+	store := &blockStore{
+		memStore: newMemStore(),
+		key:      "block",
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	c, err := NewWriteCache(store, WithWriteBehind(16, 16, time.Hour))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c.Set("block", 0)
+	c.Set("key", 1)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_ = c.Close()
+	}()
+	<-store.entered
+
+	// set while the final flush still holds key=1
+	set := make(chan struct{})
+	go func() {
+		defer close(set)
+		c.Set("key", 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(store.release)
+	<-closed
+	<-set
+
+	if val, _, _ := store.Load("key"); val != 2 {
+		t.Fatalf("store expected 2, got: %v", val)
+	}
+	if val, _ := c.lru.Get("key"); val != 2 {
+		t.Fatalf("lru expected 2, got: %v", val)
+	}
+}
+
+func TestWriteCache_FlushErrorKeepsNewer(t *testing.T) {
+	store := newMemStore()
+	c, err := NewWriteCache(store, WithWriteBehind(16, 16, time.Hour))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer c.Close()
+
+	// value of a write queued after the failed one is kept
+	c.Set("key", 1)
+	c.behind.evict("key")
+	if !c.lru.Exists("key") {
+		t.Fatalf("evict expected newer value kept")
+	}
+	store.fails = 1
+	if err := c.Flush(); err == nil {
+		t.Fatalf("Flush expected err")
+	}
+	if c.lru.Exists("key") {
+		t.Fatalf("Flush expected failed key evicted")
+	}
+}
+
+func TestNewWriteCache(t *testing.T) {
+	tests := []struct {
+		name  string
+		store Store
+		opts  []Opt
+	}{
+		{"nil store", nil, nil},
+		{"invalid retries", newMemStore(), []Opt{WithWriteRetries(-1)}},
+		{"invalid queue", newMemStore(), []Opt{WithWriteBehind(-1, 1, time.Second)}},
+		{"invalid batch", newMemStore(), []Opt{WithWriteBehind(1, 0, time.Second)}},
+		{"invalid interval", newMemStore(), []Opt{WithWriteBehind(1, 1, 0)}},
+		{"invalid lru", newMemStore(), []Opt{WithCapacity(0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWriteCache(tt.store, tt.opts...); err == nil {
+				t.Errorf("NewWriteCache() expected err")
+			}
+		})
+	}
+}
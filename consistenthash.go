@@ -1,6 +1,6 @@
 package edge
 
-// Server ConsistentHash uses String() as key when add into hash
+// Server ConsistentHash uses String() as key when add into hash, or ID() if it is a Node
 type Server interface {
 	String() string
 }
@@ -17,3 +17,39 @@ type ConsistentHash interface {
 	// Get returns an server node close to key hash.
 	Get(key string) Server
 }
+
+// WeightedServer is a Server with capacity weight, ConsistentHash gives it
+// a share of keys proportional to Weight()
+type WeightedServer interface {
+	Server
+	Weight() int
+}
+
+// Labels of the topology of a server, from the widest failure domain.
+const (
+	LabelZone = "zone"
+	LabelRack = "rack"
+	LabelHost = "host"
+)
+
+// LabeledServer is a Server with labels, like LabelZone, LabelRack and
+// LabelHost of its topology, ConsistentHash spreads replicas over them.
+type LabeledServer interface {
+	Server
+	Labels() map[string]string
+}
+
+// Node is a Server with a stable identity and metadata. ConsistentHash
+// keys it by ID() instead of String(), so renaming it moves no key, and
+// uses Weight() and Labels() as of WeightedServer and LabeledServer.
+// ID() must not be empty, and it shares one namespace with String() of
+// servers which are not Node.
+// Address() is where to reach it, hashes compatible with clients keyed by
+// address, like ketama, use it instead.
+type Node interface {
+	Server
+	ID() string
+	Weight() int
+	Labels() map[string]string
+	Address() string
+}
@@ -2,4 +2,10 @@ package hash
 
 const (
 	minReplicas = 1
+	minWeight   = 1
+
+	minTableSize = 2
+	minProbes    = 1
+
+	eventBuffer = 64
 )
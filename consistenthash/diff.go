@@ -0,0 +1,89 @@
+package hash
+
+import (
+	"math"
+	"sort"
+
+	"github.com/cyningsun/edge"
+)
+
+// Range is hashes from Start to End inclusive whose owner changes
+// From one node To another. From or To is nil if the ring is empty.
+type Range struct {
+	Start uint64
+	End   uint64
+	From  edge.Server
+	To    edge.Server
+}
+
+// Migration is the ranges moving between two rings, sorted by Start.
+type Migration struct {
+	Ranges []Range
+	hashFn HashFunc
+	keyFn  func(key string) string
+}
+
+// Diff returns the ranges which change owner from ring before to ring after.
+// Both rings must use the same hash func and key extractor, and loads of
+// bounded load mode are ignored, as they change per key.
+func Diff(before, after *ring) *Migration {
+	from, to := before.snapshot(), after.snapshot()
+	bounds := make([]uint64, 0, len(from.hashes)+len(to.hashes)+1)
+	bounds = append(bounds, from.hashes...)
+	bounds = append(bounds, to.hashes...)
+	bounds = append(bounds, math.MaxUint64)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+
+	m := &Migration{hashFn: after.hashFn, keyFn: after.keyFn}
+	var start uint64
+	for i, end := range bounds {
+		if i > 0 && end == bounds[i-1] {
+			continue
+		}
+		// owners never change inside (previous bound, end]
+		src, dst := from.owner(end), to.owner(end)
+		if !sameNode(src, dst) {
+			m.add(Range{Start: start, End: end, From: src, To: dst})
+		}
+		start = end + 1
+	}
+	return m
+}
+
+// add saves r, merging it into the last range if they are adjacent and
+// move between the same nodes.
+func (m *Migration) add(r Range) {
+	if n := len(m.Ranges); n > 0 {
+		last := &m.Ranges[n-1]
+		if last.End+1 == r.Start && sameNode(last.From, r.From) && sameNode(last.To, r.To) {
+			last.End = r.End
+			return
+		}
+	}
+	m.Ranges = append(m.Ranges, r)
+}
+
+// Moved returns whether key changes owner, and the nodes it moves between.
+func (m *Migration) Moved(key string) (from, to edge.Server, moved bool) {
+	h := m.hashFn([]byte(m.keyFn(key)))
+	idx := sort.Search(len(m.Ranges), func(i int) bool { return m.Ranges[i].End >= h })
+	if idx == len(m.Ranges) || m.Ranges[idx].Start > h {
+		return nil, nil, false
+	}
+	return m.Ranges[idx].From, m.Ranges[idx].To, true
+}
+
+// owner returns the node of hash h, nil if t is empty.
+func (t *table) owner(h uint64) edge.Server {
+	if len(t.hashes) == 0 {
+		return nil
+	}
+	return t.owners[t.search(h)]
+}
+
+func sameNode(a, b edge.Server) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return idOf(a) == idOf(b)
+}
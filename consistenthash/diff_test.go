@@ -0,0 +1,73 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+func TestDiff(t *testing.T) {
+	nodes := make([]edge.Server, 0, 10)
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+	newRing := func(members []edge.Server) *ring {
+		r, _ := NewRing(20)
+		_, _, _ = r.SetMembers(members)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		before []edge.Server
+		after  []edge.Server
+	}{
+		{"same", nodes[:5], nodes[:5]},
+		{"scale out", nodes[:5], nodes[:6]},
+		{"scale in", nodes[:6], nodes[:5]},
+		{"replace", nodes[:5], nodes[3:8]},
+		{"from empty", nil, nodes[:3]},
+		{"to empty", nodes[:3], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := newRing(tt.before), newRing(tt.after)
+			m := Diff(before, after)
+			for i, r := range m.Ranges {
+				if r.Start > r.End || (i > 0 && m.Ranges[i-1].End >= r.Start) {
+					t.Fatalf("Diff() ranges not sorted or overlapped at %v: %+v", i, m.Ranges)
+				}
+				if sameNode(r.From, r.To) {
+					t.Fatalf("Diff() range %+v not moved", r)
+				}
+			}
+
+			moved := 0
+			for i := 0; i < 10000; i++ {
+				key := strconv.Itoa(i)
+				src, dst := before.Get(key), after.Get(key)
+				from, to, ok := m.Moved(key)
+				if ok != !sameNode(src, dst) {
+					t.Fatalf("Moved(%v) = %v, want %v", key, ok, !ok)
+				}
+				if ok {
+					moved++
+					if !sameNode(from, src) || !sameNode(to, dst) {
+						t.Fatalf("Moved(%v) = %v -> %v, want %v -> %v", key, from, to, src, dst)
+					}
+				}
+			}
+			if tt.name == "scale out" && moved > 10000/6*2 {
+				t.Fatalf("scale out moved %v keys, want about %v", moved, 10000/6)
+			}
+		})
+	}
+
+	m := Diff(newRing(nil), newRing(nodes[:1]))
+	if len(m.Ranges) != 1 || m.Ranges[0].Start != 0 || m.Ranges[0].End != math.MaxUint64 {
+		t.Fatalf("Diff() from empty = %+v, want the whole ring", m.Ranges)
+	}
+}
@@ -0,0 +1,18 @@
+package hash
+
+import (
+	"errors"
+)
+
+var (
+	ErrNodeInvalid       = errors.New("hash: node invalid")
+	ErrNodeExists        = errors.New("hash: node already exists")
+	ErrNodeNotFound      = errors.New("hash: node not found")
+	ErrWeightInvalid     = errors.New("hash: weight invalid")
+	ErrNodeNotTail       = errors.New("hash: node not the last bucket")
+	ErrTableFull         = errors.New("hash: lookup table full")
+	ErrSlotInvalid       = errors.New("hash: slot invalid")
+	ErrSlotUnassigned    = errors.New("hash: slot unassigned")
+	ErrDurationInvalid   = errors.New("hash: duration invalid")
+	ErrOptionUnsupported = errors.New("hash: option unsupported")
+)
@@ -0,0 +1,102 @@
+package hash
+
+import (
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+// EventType is the kind of a ring membership change.
+type EventType int
+
+const (
+	NodeAdded EventType = iota + 1
+	NodeRemoved
+	WeightChanged
+	NodeDown
+	NodeUp
+)
+
+func (t EventType) String() string {
+	switch t {
+	case NodeAdded:
+		return "added"
+	case NodeRemoved:
+		return "removed"
+	case WeightChanged:
+		return "weight changed"
+	case NodeDown:
+		return "down"
+	case NodeUp:
+		return "up"
+	}
+	return "unknown"
+}
+
+// MembershipEvent is a change of ring. Version is the ring version after
+// the change, events of one change like SetMembers share the version, and
+// Seq numbers every event of ring one by one.
+// Weight is the weight of node added or changed.
+type MembershipEvent struct {
+	Type    EventType
+	Node    edge.Server
+	Weight  int
+	Version uint64
+	Seq     uint64
+}
+
+type subscriber struct {
+	ch   chan MembershipEvent
+	once sync.Once
+}
+
+// Subscribe returns a channel receiving changes of ring in order, and a
+// cancel func closing it. Events are dropped while the channel is full,
+// so a gap in Seq tells the subscriber to resync from the ring.
+func (r *ring) Subscribe() (<-chan MembershipEvent, func()) {
+	s := &subscriber{ch: make(chan MembershipEvent, eventBuffer)}
+
+	r.mtx.Lock()
+	r.subscribers[s] = struct{}{}
+	r.mtx.Unlock()
+
+	cancel := func() {
+		s.once.Do(func() {
+			r.mtx.Lock()
+			defer r.mtx.Unlock()
+			delete(r.subscribers, s)
+			close(s.ch)
+		})
+	}
+	return s.ch, cancel
+}
+
+// Version returns the ring version, which increases on every change.
+func (r *ring) Version() uint64 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.version
+}
+
+// notify bumps the version and sends events of one change to subscribers,
+// mtx must be held.
+func (r *ring) notify(events ...MembershipEvent) {
+	if len(events) == 0 {
+		return
+	}
+	r.version++
+	for i := range events {
+		r.seq++
+		events[i].Version = r.version
+		events[i].Seq = r.seq
+	}
+	for s := range r.subscribers {
+		for _, e := range events {
+			select {
+			case s.ch <- e:
+			default:
+				ringVar.EventDrop.Add(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package hash
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+func receive(t *testing.T, ch <-chan MembershipEvent) MembershipEvent {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+	return MembershipEvent{}
+}
+
+func Test_ring_Subscribe(t *testing.T) {
+	r, _ := NewRing(10)
+	events, cancel := r.Subscribe()
+	defer cancel()
+
+	a, b, c := testNode{val: "a"}, testNode{val: "b"}, testNode{val: "c"}
+	var seq uint64
+	expect := func(want ...MembershipEvent) {
+		t.Helper()
+		got := map[string]MembershipEvent{}
+		for range want {
+			e := receive(t, events)
+			if seq++; e.Seq != seq {
+				t.Fatalf("event seq = %v, want %v", e.Seq, seq)
+			}
+			e.Seq = 0
+			got[e.Node.String()] = e
+		}
+		for _, each := range want {
+			if e := got[each.Node.String()]; e != each {
+				t.Fatalf("event = %+v, want %+v", e, each)
+			}
+		}
+		select {
+		case e := <-events:
+			t.Fatalf("unexpected event %+v", e)
+		default:
+		}
+	}
+
+	r.Add(a)
+	expect(MembershipEvent{NodeAdded, a, 1, 1, 0})
+	_ = r.AddNode(a)
+	_ = r.SetWeight(a, 3)
+	expect(MembershipEvent{WeightChanged, a, 3, 2, 0})
+	_ = r.SetWeight(a, 3)
+	r.Add(b)
+	r.Remove(a)
+	expect(MembershipEvent{NodeAdded, b, 1, 3, 0}, MembershipEvent{NodeRemoved, a, 0, 4, 0})
+
+	_, _, _ = r.SetMembers([]edge.Server{a, weightedNode{c, 2}})
+	expect(
+		MembershipEvent{NodeAdded, a, 1, 5, 0},
+		MembershipEvent{NodeAdded, weightedNode{c, 2}, 2, 5, 0},
+		MembershipEvent{NodeRemoved, b, 0, 5, 0},
+	)
+	_, _, _ = r.SetMembers([]edge.Server{a, weightedNode{c, 2}})
+	expect()
+
+	_ = r.MarkDown(a, time.Hour)
+	_ = r.MarkDown(a, time.Hour)
+	expect(MembershipEvent{NodeDown, a, 0, 6, 0})
+	_ = r.MarkUp(a)
+	_ = r.MarkUp(a)
+	expect(MembershipEvent{NodeUp, a, 0, 7, 0})
+
+	// up again once down duration passes
+	_ = r.MarkDown(a, 10*time.Millisecond)
+	expect(MembershipEvent{NodeDown, a, 0, 8, 0})
+	if e := receive(t, events); e != (MembershipEvent{NodeUp, a, 0, 9, seq + 1}) {
+		t.Fatalf("event = %+v, want up after expired", e)
+	}
+	if r.Version() != 9 {
+		t.Fatalf("Version() = %v, want 9", r.Version())
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatalf("channel open after cancel")
+	}
+	r.Remove(a)
+}
+
+func Test_ring_SubscribeDrop(t *testing.T) {
+	r, _ := NewRing(1)
+	events, cancel := r.Subscribe()
+	defer cancel()
+
+	dropped := ringVar.EventDrop.Value()
+	for i := 0; i < eventBuffer+10; i++ {
+		r.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+	if got := ringVar.EventDrop.Value() - dropped; got != 10 {
+		t.Fatalf("dropped %v events, want 10", got)
+	}
+	for i := 0; i < eventBuffer; i++ {
+		<-events
+	}
+	r.Remove(testNode{val: "node-0"})
+	if e := receive(t, events); e.Seq != eventBuffer+11 {
+		t.Fatalf("event seq = %v, want gap to %v", e.Seq, eventBuffer+11)
+	}
+
+	// events of one change share the version, but not the seq
+	var nodes []edge.Server
+	for i := 0; i < eventBuffer+10; i++ {
+		nodes = append(nodes, testNode{val: fmt.Sprintf("member-%d", i)})
+	}
+	_, _, _ = r.SetMembers(nodes)
+	var last MembershipEvent
+	for i := 0; i < eventBuffer; i++ {
+		e := receive(t, events)
+		if i > 0 && (e.Version != last.Version || e.Seq != last.Seq+1) {
+			t.Fatalf("event %v version %v seq %v after version %v seq %v", i, e.Version, e.Seq, last.Version, last.Seq)
+		}
+		last = e
+	}
+	r.Remove(testNode{val: "member-0"})
+	if e := receive(t, events); e.Seq == last.Seq+1 {
+		t.Fatalf("event seq = %v, want gap after %v", e.Seq, last.Seq)
+	}
+}
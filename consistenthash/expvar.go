@@ -5,11 +5,77 @@ import (
 )
 
 var ringVar = struct {
+	Add       *expvar.Int
+	Remove    *expvar.Int
+	Set       *expvar.Int
+	Get       *expvar.Int
+	Eject     *expvar.Int
+	EventDrop *expvar.Int
+}{
+	Add:       expvar.NewInt("hash.ringhash.add"),
+	Remove:    expvar.NewInt("hash.ringhash.remove"),
+	Set:       expvar.NewInt("hash.ringhash.set"),
+	Get:       expvar.NewInt("hash.ringhash.get"),
+	Eject:     expvar.NewInt("hash.ringhash.eject"),
+	EventDrop: expvar.NewInt("hash.ringhash.event.drop"),
+}
+
+var jumpVar = struct {
+	Add    *expvar.Int
+	Remove *expvar.Int
+	Get    *expvar.Int
+}{
+	Add:    expvar.NewInt("hash.jump.add"),
+	Remove: expvar.NewInt("hash.jump.remove"),
+	Get:    expvar.NewInt("hash.jump.get"),
+}
+
+var rendezvousVar = struct {
+	Add    *expvar.Int
+	Remove *expvar.Int
+	Get    *expvar.Int
+}{
+	Add:    expvar.NewInt("hash.rendezvous.add"),
+	Remove: expvar.NewInt("hash.rendezvous.remove"),
+	Get:    expvar.NewInt("hash.rendezvous.get"),
+}
+
+var maglevVar = struct {
+	Add    *expvar.Int
+	Remove *expvar.Int
+	Get    *expvar.Int
+}{
+	Add:    expvar.NewInt("hash.maglev.add"),
+	Remove: expvar.NewInt("hash.maglev.remove"),
+	Get:    expvar.NewInt("hash.maglev.get"),
+}
+
+var multiProbeVar = struct {
+	Add    *expvar.Int
+	Remove *expvar.Int
+	Get    *expvar.Int
+}{
+	Add:    expvar.NewInt("hash.multiprobe.add"),
+	Remove: expvar.NewInt("hash.multiprobe.remove"),
+	Get:    expvar.NewInt("hash.multiprobe.get"),
+}
+
+var ketamaVar = struct {
+	Add    *expvar.Int
+	Remove *expvar.Int
+	Get    *expvar.Int
+}{
+	Add:    expvar.NewInt("hash.ketama.add"),
+	Remove: expvar.NewInt("hash.ketama.remove"),
+	Get:    expvar.NewInt("hash.ketama.get"),
+}
+
+var slotsVar = struct {
 	Add    *expvar.Int
 	Remove *expvar.Int
 	Get    *expvar.Int
 }{
-	Add:    expvar.NewInt("hash.ringhash.add"),
-	Remove: expvar.NewInt("hash.ringhash.remove"),
-	Get:    expvar.NewInt("hash.ringhash.get"),
+	Add:    expvar.NewInt("hash.slots.add"),
+	Remove: expvar.NewInt("hash.slots.remove"),
+	Get:    expvar.NewInt("hash.slots.get"),
 }
@@ -0,0 +1,210 @@
+package hash
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/bits"
+)
+
+// HashFunc hashes data into a position on the ring.
+type HashFunc func(data []byte) uint64
+
+// FNV32a is 32-bit FNV-1a, positions of it are the same as rings before
+// 64-bit positions, so keys are placed exactly as before.
+func FNV32a(data []byte) uint64 {
+	h := fnv.New32a()
+	_, _ = h.Write(data)
+	return uint64(h.Sum32())
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+// XXHash64 is xxHash64 with seed 0.
+// ref: https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+func XXHash64(data []byte) uint64 {
+	n := len(data)
+	var h uint64
+	if n >= 32 {
+		v1, v2, v3, v4 := xxPrime1, xxPrime2, uint64(0), uint64(0)
+		v1 += xxPrime2
+		v4 -= xxPrime1
+		for len(data) >= 32 {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(data[0:]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(data[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(data[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(data[24:]))
+			data = data[32:]
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = xxPrime5
+	}
+
+	h += uint64(n)
+	for ; len(data) >= 8; data = data[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(data))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(data) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(data)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		data = data[4:]
+	}
+	for _, b := range data {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+const (
+	murmurC1 uint64 = 0x87c37b91114253d5
+	murmurC2 uint64 = 0x4cf5ad432745937f
+)
+
+// Murmur3 is the first 64 bits of MurmurHash3 x64 128 with seed 0.
+// ref: https://github.com/aappleby/smhasher/blob/master/src/MurmurHash3.cpp
+func Murmur3(data []byte) uint64 {
+	n := len(data)
+	var h1, h2 uint64
+	for ; len(data) >= 16; data = data[16:] {
+		k1 := binary.LittleEndian.Uint64(data)
+		k2 := binary.LittleEndian.Uint64(data[8:])
+
+		h1 ^= murmurK1(k1)
+		h1 = bits.RotateLeft64(h1, 27) + h2
+		h1 = h1*5 + 0x52dce729
+
+		h2 ^= murmurK2(k2)
+		h2 = bits.RotateLeft64(h2, 31) + h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	for i := len(data) - 1; i >= 8; i-- {
+		k2 = k2<<8 | uint64(data[i])
+	}
+	if len(data) > 8 {
+		h2 ^= murmurK2(k2)
+	}
+	tail := len(data)
+	if tail > 8 {
+		tail = 8
+	}
+	for i := tail - 1; i >= 0; i-- {
+		k1 = k1<<8 | uint64(data[i])
+	}
+	if len(data) > 0 {
+		h1 ^= murmurK1(k1)
+	}
+
+	h1 ^= uint64(n)
+	h2 ^= uint64(n)
+	h1 += h2
+	h2 += h1
+	h1 = murmurMix(h1)
+	h2 = murmurMix(h2)
+	h1 += h2
+	return h1
+}
+
+func murmurK1(k uint64) uint64 {
+	k *= murmurC1
+	k = bits.RotateLeft64(k, 31)
+	return k * murmurC2
+}
+
+func murmurK2(k uint64) uint64 {
+	k *= murmurC2
+	k = bits.RotateLeft64(k, 33)
+	return k * murmurC1
+}
+
+func murmurMix(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+// SipHash returns SipHash-2-4 keyed by k0, k1. Rings sharing the key
+// place keys the same, while others can't predict positions.
+// ref: https://www.aumasson.jp/siphash/siphash.pdf
+func SipHash(k0, k1 uint64) HashFunc {
+	return func(data []byte) uint64 {
+		v0 := k0 ^ 0x736f6d6570736575
+		v1 := k1 ^ 0x646f72616e646f6d
+		v2 := k0 ^ 0x6c7967656e657261
+		v3 := k1 ^ 0x7465646279746573
+
+		round := func() {
+			v0 += v1
+			v1 = bits.RotateLeft64(v1, 13)
+			v1 ^= v0
+			v0 = bits.RotateLeft64(v0, 32)
+			v2 += v3
+			v3 = bits.RotateLeft64(v3, 16)
+			v3 ^= v2
+			v0 += v3
+			v3 = bits.RotateLeft64(v3, 21)
+			v3 ^= v0
+			v2 += v1
+			v1 = bits.RotateLeft64(v1, 17)
+			v1 ^= v2
+			v2 = bits.RotateLeft64(v2, 32)
+		}
+
+		n := len(data)
+		for ; len(data) >= 8; data = data[8:] {
+			m := binary.LittleEndian.Uint64(data)
+			v3 ^= m
+			round()
+			round()
+			v0 ^= m
+		}
+		last := uint64(n) << 56
+		for i := len(data) - 1; i >= 0; i-- {
+			last |= uint64(data[i]) << (8 * uint(i))
+		}
+		v3 ^= last
+		round()
+		round()
+		v0 ^= last
+
+		v2 ^= 0xff
+		round()
+		round()
+		round()
+		round()
+		return v0 ^ v1 ^ v2 ^ v3
+	}
+}
@@ -0,0 +1,37 @@
+package hash
+
+import (
+	"testing"
+)
+
+func TestHashFunc(t *testing.T) {
+	message := make([]byte, 15)
+	for i := range message {
+		message[i] = byte(i)
+	}
+	sip := SipHash(0x0706050403020100, 0x0f0e0d0c0b0a0908)
+
+	tests := []struct {
+		name string
+		fn   HashFunc
+		data string
+		want uint64
+	}{
+		{"xxhash64 empty", XXHash64, "", 0xef46db3751d8e999},
+		{"xxhash64 short", XXHash64, "abc", 0x44bc2cf5ad770999},
+		{"xxhash64 long", XXHash64, "Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+		{"murmur3 empty", Murmur3, "", 0},
+		{"murmur3 short", Murmur3, "hello", 0xcbd8a7b341bd9b02},
+		{"murmur3 long", Murmur3, "The quick brown fox jumps over the lazy dog", 0xe34bbc7bbc071b6c},
+		// vectors of the reference implementation, key is 00..0f
+		{"siphash empty", sip, "", 0x726fdb47dd0e0e31},
+		{"siphash", sip, string(message), 0xa129ca6149be45e5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn([]byte(tt.data)); got != tt.want {
+				t.Errorf("%v(%q) = %x, want %x", tt.name, tt.data, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package hash
+
+import (
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+// outliers ejects nodes reporting consecutive errors, for base duration
+// at first, doubled on each ejection up to max. A node healthy for max
+// since its last ejection starts from base again.
+type outliers struct {
+	consecutive int
+	base        time.Duration
+	max         time.Duration
+	nodes       map[string]*outlier
+}
+
+type outlier struct {
+	errors    int
+	ejections int
+	until     time.Time
+}
+
+// MarkDown makes Get skip node for d, its keys fall through to the next
+// node clockwise, and go back to it once d passes or MarkUp is called.
+// Its vnodes are kept, so no other key moves.
+func (r *ring) MarkDown(node edge.Server, d time.Duration) error {
+	switch {
+	case node == nil:
+		return ErrNodeInvalid
+	case d <= 0:
+		return ErrDurationInvalid
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exist := r.nodes[idOf(node)]; !exist {
+		return ErrNodeNotFound
+	}
+	r.markDown(idOf(node), time.Now().Add(d))
+	return nil
+}
+
+// MarkUp makes Get choose node again, before its down duration passes.
+func (r *ring) MarkUp(node edge.Server) error {
+	if node == nil {
+		return ErrNodeInvalid
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exist := r.nodes[idOf(node)]; !exist {
+		return ErrNodeNotFound
+	}
+	if r.outliers != nil {
+		if o, ok := r.outliers.nodes[idOf(node)]; ok {
+			o.errors = 0
+		}
+	}
+	r.markUp(idOf(node))
+	return nil
+}
+
+// IsDown returns whether Get skips node now.
+func (r *ring) IsDown(node edge.Server) bool {
+	return r.snapshot().isDown(node, time.Now())
+}
+
+// ReportError counts one more consecutive error of node. With outlier
+// ejection, node is marked down once errors reach the threshold.
+func (r *ring) ReportError(node edge.Server) {
+	if r.outliers == nil || node == nil {
+		return
+	}
+	name := idOf(node)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exist := r.nodes[name]; !exist {
+		return
+	}
+	o, ok := r.outliers.nodes[name]
+	if !ok {
+		o = &outlier{}
+		r.outliers.nodes[name] = o
+	}
+	o.errors++
+	if o.errors < r.outliers.consecutive {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(o.until) >= r.outliers.max {
+		o.ejections = 0
+	}
+	o.errors = 0
+	o.ejections++
+	o.until = now.Add(r.outliers.backoff(o.ejections))
+	r.markDown(name, o.until)
+	ringVar.Eject.Add(1)
+}
+
+// ReportSuccess resets consecutive errors of node.
+func (r *ring) ReportSuccess(node edge.Server) {
+	if r.outliers == nil || node == nil {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if o, ok := r.outliers.nodes[idOf(node)]; ok {
+		o.errors = 0
+	}
+}
+
+// backoff returns base doubled for each ejection after the first, up to max.
+func (o *outliers) backoff(ejections int) time.Duration {
+	d := o.base
+	for i := 1; i < ejections && d < o.max; i++ {
+		d *= 2
+	}
+	if d > o.max {
+		d = o.max
+	}
+	return d
+}
+
+// markDown makes node name down until the time, and up again then by
+// a timer, mtx must be held.
+func (r *ring) markDown(name string, until time.Time) {
+	_, down := r.down[name]
+	r.down[name] = until
+	if timer, ok := r.upTimers[name]; ok {
+		timer.Stop()
+	}
+	r.upTimers[name] = time.AfterFunc(time.Until(until), func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		if r.down[name].Equal(until) {
+			r.markUp(name)
+		}
+	})
+	r.publishDown()
+	if !down {
+		r.notify(MembershipEvent{Type: NodeDown, Node: r.nodes[name]})
+	}
+}
+
+// markUp makes node name up, mtx must be held.
+func (r *ring) markUp(name string) {
+	if _, down := r.down[name]; !down {
+		return
+	}
+	delete(r.down, name)
+	if timer, ok := r.upTimers[name]; ok {
+		timer.Stop()
+		delete(r.upTimers, name)
+	}
+	r.publishDown()
+	r.notify(MembershipEvent{Type: NodeUp, Node: r.nodes[name]})
+}
+
+// forget drops health of node name, mtx must be held.
+func (r *ring) forget(name string) {
+	delete(r.down, name)
+	if timer, ok := r.upTimers[name]; ok {
+		timer.Stop()
+		delete(r.upTimers, name)
+	}
+	if r.outliers != nil {
+		delete(r.outliers.nodes, name)
+	}
+}
+
+// publishDown publishes the table last published with nodes down now,
+// mtx must be held.
+func (r *ring) publishDown() {
+	t := *r.snapshot()
+	t.down = r.downNodes()
+	r.table.Store(&t)
+}
+
+// downNodes returns a copy of nodes still down, mtx must be held.
+func (r *ring) downNodes() map[string]time.Time {
+	now := time.Now()
+	var down map[string]time.Time
+	for name, until := range r.down {
+		if !now.Before(until) {
+			continue
+		}
+		if down == nil {
+			down = make(map[string]time.Time, len(r.down))
+		}
+		down[name] = until
+	}
+	return down
+}
+
+func (t *table) isDown(node edge.Server, now time.Time) bool {
+	until, ok := t.down[idOf(node)]
+	return ok && now.Before(until)
+}
+
+// healthy returns the first node up clockwise from the vnode at idx, or the
+// node of idx if all are down.
+func (t *table) healthy(idx int) edge.Server {
+	if len(t.down) == 0 {
+		return t.owners[idx]
+	}
+	now := time.Now()
+	for i := 0; i < len(t.owners); i++ {
+		node := t.owners[(idx+i)%len(t.owners)]
+		if !t.isDown(node, now) {
+			return node
+		}
+	}
+	return t.owners[idx]
+}
@@ -0,0 +1,178 @@
+package hash
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+func newHealthRing(t *testing.T, opts ...Opt) (*ring, []edge.Server) {
+	t.Helper()
+	r, err := NewRing(50, opts...)
+	if err != nil {
+		t.Fatalf("NewRing() error = %v", err)
+	}
+	nodes := make([]edge.Server, 0, 5)
+	for i := 1; i <= 5; i++ {
+		node := testNodeData[fmt.Sprintf("testNode%d", i)]
+		r.Add(node)
+		nodes = append(nodes, node)
+	}
+	return r, nodes
+}
+
+func Test_ring_MarkDown(t *testing.T) {
+	r, nodes := newHealthRing(t)
+	down := nodes[2]
+	if err := r.MarkDown(testNode{val: "absent"}, time.Hour); err != ErrNodeNotFound {
+		t.Fatalf("MarkDown() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	if err := r.MarkDown(down, 0); err != ErrDurationInvalid {
+		t.Fatalf("MarkDown() error = %v, want %v", err, ErrDurationInvalid)
+	}
+
+	before := map[string]edge.Server{}
+	for i := 0; i < 10000; i++ {
+		before[strconv.Itoa(i)] = r.Get(strconv.Itoa(i))
+	}
+	if err := r.MarkDown(down, time.Hour); err != nil {
+		t.Fatalf("MarkDown() error = %v", err)
+	}
+	if !r.IsDown(down) || r.IsDown(nodes[0]) {
+		t.Fatalf("IsDown() = %v, %v, want true, false", r.IsDown(down), r.IsDown(nodes[0]))
+	}
+	for key, node := range before {
+		got := r.Get(key)
+		if got == down || (node != down && got != node) {
+			t.Fatalf("Get(%v) = %v while %v down, want %v", key, got, down, node)
+		}
+		if list := r.GetN(key, 5); len(list) != 5 || list[4] != down {
+			t.Fatalf("GetN(%v) = %v, want %v last", key, list, down)
+		}
+	}
+
+	if err := r.MarkUp(down); err != nil {
+		t.Fatalf("MarkUp() error = %v", err)
+	}
+	for key, node := range before {
+		if got := r.Get(key); got != node {
+			t.Fatalf("Get(%v) = %v after MarkUp, want %v", key, got, node)
+		}
+	}
+
+	// down expires
+	_ = r.MarkDown(down, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	for key, node := range before {
+		if got := r.Get(key); got != node {
+			t.Fatalf("Get(%v) = %v after expired, want %v", key, got, node)
+		}
+	}
+
+	// all nodes down falls back to the owner
+	for _, node := range nodes {
+		_ = r.MarkDown(node, time.Hour)
+	}
+	for key, node := range before {
+		if got := r.Get(key); got != node {
+			t.Fatalf("Get(%v) = %v with all down, want %v", key, got, node)
+		}
+	}
+
+	r.Remove(down)
+	r.Add(down)
+	if r.IsDown(down) {
+		t.Fatalf("IsDown() = true after re-added")
+	}
+	checkRing(t, r)
+}
+
+func Test_ring_MarkDownBoundedLoad(t *testing.T) {
+	r, nodes := newHealthRing(t, WithBoundedLoad(0.25))
+	_ = r.MarkDown(nodes[0], time.Hour)
+	for i := 0; i < 1000; i++ {
+		if got := r.Acquire(strconv.Itoa(i)); got == nodes[0] {
+			t.Fatalf("Acquire() = %v while down", got)
+		}
+	}
+	if r.Load(nodes[0]) != 0 {
+		t.Fatalf("Load() = %v of node down, want 0", r.Load(nodes[0]))
+	}
+}
+
+func Test_ring_OutlierEjection(t *testing.T) {
+	r, nodes := newHealthRing(t, WithOutlierEjection(3, time.Hour, 4*time.Hour))
+	node := nodes[1]
+
+	r.ReportError(node)
+	r.ReportError(node)
+	r.ReportSuccess(node)
+	r.ReportError(node)
+	r.ReportError(node)
+	if r.IsDown(node) {
+		t.Fatalf("IsDown() = true before consecutive errors")
+	}
+	r.ReportError(node)
+	if !r.IsDown(node) {
+		t.Fatalf("IsDown() = false after consecutive errors")
+	}
+
+	for want := 2; want <= 4; want++ {
+		_ = r.MarkUp(node)
+		for i := 0; i < 3; i++ {
+			r.ReportError(node)
+		}
+		o := r.outliers.nodes[node.String()]
+		if o.ejections != want {
+			t.Fatalf("ejections = %v, want %v", o.ejections, want)
+		}
+		if d := time.Until(o.until); d <= r.outliers.backoff(want)-time.Minute {
+			t.Fatalf("ejected for %v, want %v", d, r.outliers.backoff(want))
+		}
+	}
+
+	r.Remove(node)
+	if _, ok := r.outliers.nodes[node.String()]; ok {
+		t.Fatalf("outlier kept after Remove")
+	}
+	r.ReportError(node)
+	if _, ok := r.outliers.nodes[node.String()]; ok {
+		t.Fatalf("outlier of non member counted")
+	}
+}
+
+func Test_outliers_backoff(t *testing.T) {
+	o := &outliers{base: 10 * time.Millisecond, max: 80 * time.Millisecond}
+	want := []time.Duration{10, 20, 40, 80, 80, 80}
+	for i, each := range want {
+		if got := o.backoff(i + 1); got != each*time.Millisecond {
+			t.Errorf("backoff(%v) = %v, want %v", i+1, got, each*time.Millisecond)
+		}
+	}
+}
+
+func TestNewRing_OutlierEjection(t *testing.T) {
+	tests := []struct {
+		name        string
+		consecutive int
+		base, max   time.Duration
+		wantErr     bool
+	}{
+		{"disabled", 0, 0, 0, false},
+		{"normal", 5, time.Second, time.Minute, false},
+		{"negative errors", -1, time.Second, time.Minute, true},
+		{"zero base", 5, 0, time.Minute, true},
+		{"max below base", 5, time.Minute, time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRing(1, WithOutlierEjection(tt.consecutive, tt.base, tt.max))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
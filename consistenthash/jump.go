@@ -0,0 +1,117 @@
+package hash
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+var _ edge.ConsistentHash = &jump{}
+
+// jump maps keys to buckets with jump consistent hash, bucket i is the
+// i-th node added. It needs no vnode table, but nodes can only be added
+// and removed at the tail.
+// ref: https://arxiv.org/abs/1406.2294
+type jump struct {
+	nodes []edge.Server
+	index map[string]int
+	keyFn func(key string) string
+	mtx   sync.RWMutex
+}
+
+// NewJump creates jump, only WithHashTag and WithKeyExtractor of opts apply.
+func NewJump(opts ...Opt) (*jump, error) {
+	options := newOptions(opts...)
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &jump{
+		nodes: []edge.Server{},
+		index: map[string]int{},
+		keyFn: options.keyFnOr(wholeKey),
+	}, nil
+}
+
+// Add appends node as the last bucket, node already exists is ignored.
+func (j *jump) Add(node edge.Server) {
+	_ = j.AddNode(node)
+}
+
+// AddNode appends node as the last bucket.
+func (j *jump) AddNode(node edge.Server) error {
+	jumpVar.Add.Add(1)
+
+	if unnamed(node) {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	if _, exist := j.index[name]; exist {
+		return ErrNodeExists
+	}
+	j.index[name] = len(j.nodes)
+	j.nodes = append(j.nodes, node)
+	return nil
+}
+
+// Remove deletes node if it is the last bucket, otherwise it is ignored.
+func (j *jump) Remove(node edge.Server) {
+	_ = j.RemoveNode(node)
+}
+
+// RemoveNode deletes node, which must be the last bucket, since removing
+// others would move keys of every bucket after it.
+func (j *jump) RemoveNode(node edge.Server) error {
+	jumpVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+	idx, exist := j.index[name]
+	switch {
+	case !exist:
+		return ErrNodeNotFound
+	case idx != len(j.nodes)-1:
+		return ErrNodeNotTail
+	}
+	delete(j.index, name)
+	j.nodes[idx] = nil
+	j.nodes = j.nodes[:idx]
+	return nil
+}
+
+func (j *jump) Get(key string) edge.Server {
+	jumpVar.Get.Add(1)
+
+	h := hash64(j.keyFn(key))
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+	if len(j.nodes) == 0 {
+		return nil
+	}
+	return j.nodes[jumpHash(h, len(j.nodes))]
+}
+
+// jumpHash returns bucket in [0, buckets) of key.
+func jumpHash(key uint64, buckets int) int {
+	b, j := int64(-1), int64(0)
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func hash64(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum64()
+}
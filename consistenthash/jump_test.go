@@ -0,0 +1,95 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+func Test_jumpHash(t *testing.T) {
+	// vectors of the reference implementation in the paper
+	tests := []struct {
+		key     uint64
+		buckets int
+		want    int
+	}{
+		{1, 1, 0},
+		{42, 57, 43},
+		{0xDEAD10CC, 1, 0},
+		{0xDEAD10CC, 666, 361},
+		{256, 1024, 520},
+	}
+	for _, tt := range tests {
+		if got := jumpHash(tt.key, tt.buckets); got != tt.want {
+			t.Errorf("jumpHash(%v, %v) = %v, want %v", tt.key, tt.buckets, got, tt.want)
+		}
+	}
+}
+
+func Test_jump_AddRemove(t *testing.T) {
+	j, _ := NewJump()
+	if got := j.Get("key"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := j.AddNode(testNodeData[fmt.Sprintf("testNode%d", i)]); err != nil {
+			t.Fatalf("AddNode() error = %v", err)
+		}
+	}
+	if err := j.AddNode(testNodeData["testNode1"]); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+	if err := j.RemoveNode(testNodeData["testNode1"]); err != ErrNodeNotTail {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotTail)
+	}
+	if err := j.RemoveNode(testNodeData["testNode5"]); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotFound)
+	}
+
+	before := map[string]edge.Server{}
+	for i := 0; i < 10000; i++ {
+		before[strconv.Itoa(i)] = j.Get(strconv.Itoa(i))
+	}
+	j.Add(testNodeData["testNode4"])
+	moved := 0
+	for key, node := range before {
+		got := j.Get(key)
+		if got != node {
+			moved++
+			if got != testNodeData["testNode4"] {
+				t.Fatalf("key %v moved from %v to %v, want only to the new node", key, node, got)
+			}
+		}
+	}
+	if math.Abs(float64(moved)/10000-0.25) > 0.02 {
+		t.Fatalf("moved %v keys, want about 1/4", moved)
+	}
+
+	if err := j.RemoveNode(testNodeData["testNode4"]); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	for key, node := range before {
+		if got := j.Get(key); got != node {
+			t.Fatalf("key %v = %v after removing tail, want %v", key, got, node)
+		}
+	}
+}
+
+func Test_jump_Distribution(t *testing.T) {
+	j, _ := NewJump()
+	for i := 0; i < 10; i++ {
+		j.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+	counts := map[edge.Server]int{}
+	for i := 0; i < 100000; i++ {
+		counts[j.Get(strconv.Itoa(i))]++
+	}
+	for node, count := range counts {
+		if math.Abs(float64(count)/10000-1) > 0.05 {
+			t.Fatalf("node %v got %v keys, want about 10000", node, count)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package hash
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+const (
+	ketamaPointsPerServer = 160
+	ketamaPointsPerHash   = 4
+)
+
+var _ edge.ConsistentHash = &ketama{}
+
+// ketama lays out points as libmemcached weighted ketama and twemproxy do,
+// so that it picks the same server of a key as their clients, given the
+// same server names. Points of edge.Node are named by Address(), others by
+// String().
+// twemproxy names servers "host:port" and hashes keys by fnv1a_64 by
+// default, so pools must set "hash: md5" to agree. libmemcached names
+// servers "host" on the default port 11211, and "host:port" on others, so
+// nodes must be named without ":11211" to agree with it.
+// Each server has 160*weight*servers/totalWeight points, rounded down to a
+// multiple of 4, and every MD5 digest of "name-i" gives 4 points.
+// ref: https://github.com/twitter/twemproxy/blob/master/src/hashkit/nc_ketama.c
+type ketama struct {
+	nodes   map[string]edge.Server
+	weights map[string]int
+	points  []ketamaPoint
+	keyFn   func(key string) string
+	mtx     sync.RWMutex
+}
+
+type ketamaPoint struct {
+	hash uint32
+	node edge.Server
+}
+
+// NewKetama creates ketama, only WithHashTag and WithKeyExtractor of opts
+// apply, other clients must extract the same part of keys to agree.
+func NewKetama(opts ...Opt) (*ketama, error) {
+	options := newOptions(opts...)
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &ketama{
+		nodes:   map[string]edge.Server{},
+		weights: map[string]int{},
+		points:  []ketamaPoint{},
+		keyFn:   options.keyFnOr(wholeKey),
+	}, nil
+}
+
+// Add saves node into hash, node already exists is ignored.
+func (k *ketama) Add(node edge.Server) {
+	_ = k.AddNode(node)
+}
+
+// AddNode saves node, weighted by Weight() if node is edge.WeightedServer.
+func (k *ketama) AddNode(node edge.Server) error {
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	return k.AddWeighted(node, weightOf(node))
+}
+
+// AddWeighted saves node with weight. As points of all nodes depend on
+// the total weight, the continuum is rebuilt.
+func (k *ketama) AddWeighted(node edge.Server, weight int) error {
+	ketamaVar.Add.Add(1)
+
+	switch {
+	case unnamed(node):
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+	name := idOf(node)
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if _, exist := k.nodes[name]; exist {
+		return ErrNodeExists
+	}
+	k.nodes[name] = node
+	k.weights[name] = weight
+	k.rebuild()
+	return nil
+}
+
+// SetWeight changes weight of node.
+func (k *ketama) SetWeight(node edge.Server, weight int) error {
+	switch {
+	case node == nil:
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if _, exist := k.nodes[idOf(node)]; !exist {
+		return ErrNodeNotFound
+	}
+	k.weights[idOf(node)] = weight
+	k.rebuild()
+	return nil
+}
+
+// Remove deletes node from hash, node not exists is ignored.
+func (k *ketama) Remove(node edge.Server) {
+	_ = k.RemoveNode(node)
+}
+
+// RemoveNode deletes node from hash.
+func (k *ketama) RemoveNode(node edge.Server) error {
+	ketamaVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	if _, exist := k.nodes[name]; !exist {
+		return ErrNodeNotFound
+	}
+	delete(k.nodes, name)
+	delete(k.weights, name)
+	k.rebuild()
+	return nil
+}
+
+func (k *ketama) Get(key string) edge.Server {
+	ketamaVar.Get.Add(1)
+
+	h := ketamaHash([]byte(k.keyFn(key)))
+	k.mtx.RLock()
+	defer k.mtx.RUnlock()
+	if len(k.points) == 0 {
+		return nil
+	}
+	idx := sort.Search(len(k.points), func(i int) bool { return k.points[i].hash >= h })
+	if idx == len(k.points) {
+		idx = 0
+	}
+	return k.points[idx].node
+}
+
+// rebuild lays out points of all nodes, mtx must be held.
+func (k *ketama) rebuild() {
+	names := make([]string, 0, len(k.nodes))
+	total := 0
+	for name := range k.nodes {
+		names = append(names, name)
+		total += k.weights[name]
+	}
+	sort.Strings(names)
+
+	points := make([]ketamaPoint, 0, len(names)*ketamaPointsPerServer)
+	for _, name := range names {
+		count := ketamaPoints(k.weights[name], total, len(names))
+		for i := 0; i < count/ketamaPointsPerHash; i++ {
+			digest := md5.Sum([]byte(addressOf(k.nodes[name]) + "-" + strconv.Itoa(i)))
+			for j := 0; j < ketamaPointsPerHash; j++ {
+				h := binary.LittleEndian.Uint32(digest[j*4:])
+				points = append(points, ketamaPoint{h, k.nodes[name]})
+			}
+		}
+	}
+	// points of the same hash are ordered by name, as the reference leaves
+	// it to qsort
+	sort.SliceStable(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	k.points = points
+}
+
+// addressOf returns the server name of node for its points, which is
+// taken as is, the default port of libmemcached is not dropped.
+func addressOf(node edge.Server) string {
+	if n, ok := node.(edge.Node); ok {
+		return n.Address()
+	}
+	return node.String()
+}
+
+// ketamaPoints returns points of a node, computed in float32 as the
+// reference does, so that rounding matches.
+func ketamaPoints(weight, total, servers int) int {
+	pct := float32(weight) / float32(total)
+	scaled := float32(float32(pct*ketamaPointsPerServer)/ketamaPointsPerHash) * float32(servers)
+	return int(math.Floor(float64(float32(float64(scaled)+0.0000000001)))) * ketamaPointsPerHash
+}
+
+// ketamaHash returns the first little endian uint32 of MD5 of key, as
+// libmemcached ketama and twemproxy of "hash: md5" do.
+func ketamaHash(key []byte) uint32 {
+	digest := md5.Sum(key)
+	return binary.LittleEndian.Uint32(digest[:])
+}
@@ -0,0 +1,180 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+var ketamaServers = []string{
+	"10.0.1.1:11211",
+	"10.0.1.2:11211",
+	"10.0.1.3:11211",
+	"10.0.1.4:11211",
+	"10.0.1.5:11211",
+}
+
+// libmemcached drops the default port from names of points
+var libmemcachedServers = []string{
+	"10.0.1.1",
+	"10.0.1.2",
+	"10.0.1.3",
+	"10.0.1.4",
+	"10.0.1.5",
+}
+
+// Test vectors of ketamaServers are computed by the continuum of twemproxy
+// nc_ketama.c of "hash: md5", those of libmemcachedServers by the continuum
+// of libmemcached weighted ketama, naming points "host-i" on port 11211.
+func Test_ketama_Reference(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []string
+		weights []int
+		points  []int
+		first   []uint32
+		keys    map[string]string
+	}{
+		{
+			"equal weights",
+			ketamaServers,
+			[]int{1, 1, 1, 1, 1},
+			[]int{160, 160, 160, 160, 160},
+			[]uint32{762113, 2322555, 4398564},
+			map[string]string{
+				"foo":       "10.0.1.2:11211",
+				"bar":       "10.0.1.5:11211",
+				"baz":       "10.0.1.2:11211",
+				"hello":     "10.0.1.4:11211",
+				"world":     "10.0.1.1:11211",
+				"memcached": "10.0.1.3:11211",
+				"twemproxy": "10.0.1.3:11211",
+				"key:1":     "10.0.1.3:11211",
+				"key:2":     "10.0.1.5:11211",
+				"user:1000": "10.0.1.4:11211",
+			},
+		},
+		{
+			"weighted",
+			ketamaServers,
+			[]int{1, 2, 3, 4, 5},
+			[]int{52, 104, 160, 212, 264},
+			[]uint32{762113, 2322555, 4398564},
+			map[string]string{
+				"foo":       "10.0.1.2:11211",
+				"bar":       "10.0.1.5:11211",
+				"baz":       "10.0.1.2:11211",
+				"hello":     "10.0.1.4:11211",
+				"world":     "10.0.1.3:11211",
+				"memcached": "10.0.1.3:11211",
+				"twemproxy": "10.0.1.3:11211",
+				"key:1":     "10.0.1.5:11211",
+				"key:2":     "10.0.1.5:11211",
+				"user:1000": "10.0.1.4:11211",
+			},
+		},
+		{
+			"libmemcached default port",
+			libmemcachedServers,
+			[]int{1, 1, 1, 1, 1},
+			[]int{160, 160, 160, 160, 160},
+			[]uint32{2148620, 3283091, 6739652},
+			map[string]string{
+				"foo":       "10.0.1.3",
+				"bar":       "10.0.1.5",
+				"baz":       "10.0.1.4",
+				"hello":     "10.0.1.5",
+				"world":     "10.0.1.2",
+				"memcached": "10.0.1.5",
+				"twemproxy": "10.0.1.4",
+				"key:1":     "10.0.1.5",
+				"key:2":     "10.0.1.5",
+				"user:1000": "10.0.1.2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, _ := NewKetama()
+			total := 0
+			for i, server := range tt.servers {
+				if err := k.AddWeighted(testNode{val: server}, tt.weights[i]); err != nil {
+					t.Fatalf("AddWeighted() error = %v", err)
+				}
+				total += tt.weights[i]
+			}
+			for i, server := range tt.servers {
+				if got := ketamaPoints(tt.weights[i], total, len(tt.servers)); got != tt.points[i] {
+					t.Fatalf("points of %v = %v, want %v", server, got, tt.points[i])
+				}
+			}
+			for i, h := range tt.first {
+				if k.points[i].hash != h {
+					t.Fatalf("point %v = %v, want %v", i, k.points[i].hash, h)
+				}
+			}
+			for key, server := range tt.keys {
+				if got := k.Get(key); got.String() != server {
+					t.Fatalf("Get(%v) = %v, want %v", key, got, server)
+				}
+			}
+		})
+	}
+}
+
+func Test_ketama_AddRemove(t *testing.T) {
+	k, _ := NewKetama()
+	if got := k.Get("key"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := k.AddNode(testNodeData[fmt.Sprintf("testNode%d", i)]); err != nil {
+			t.Fatalf("AddNode() error = %v", err)
+		}
+	}
+	if err := k.AddNode(testNodeData["testNode1"]); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+	if err := k.AddWeighted(testNode{val: "zero"}, 0); err != ErrWeightInvalid {
+		t.Fatalf("AddWeighted() error = %v, want %v", err, ErrWeightInvalid)
+	}
+	if len(k.points) != 5*ketamaPointsPerServer {
+		t.Fatalf("points = %v, want %v", len(k.points), 5*ketamaPointsPerServer)
+	}
+
+	before := map[string]edge.Server{}
+	counts := map[edge.Server]int{}
+	for i := 0; i < 50000; i++ {
+		node := k.Get(strconv.Itoa(i))
+		before[strconv.Itoa(i)] = node
+		counts[node]++
+	}
+	for node, count := range counts {
+		if math.Abs(float64(count)/10000-1) > 0.2 {
+			t.Fatalf("node %v got %v keys, want about 10000", node, count)
+		}
+	}
+
+	removed := testNodeData["testNode3"]
+	if err := k.RemoveNode(removed); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	if err := k.RemoveNode(removed); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	for key, node := range before {
+		if got := k.Get(key); node != removed && got != node {
+			t.Fatalf("key %v moved from %v to %v, want only keys of removed node", key, node, got)
+		}
+	}
+
+	if err := k.SetWeight(testNodeData["testNode1"], 2); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	if err := k.SetWeight(removed, 2); err != ErrNodeNotFound {
+		t.Fatalf("SetWeight() error = %v, want %v", err, ErrNodeNotFound)
+	}
+}
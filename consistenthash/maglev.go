@@ -0,0 +1,198 @@
+package hash
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+var _ edge.ConsistentHash = &maglev{}
+
+// maglev maps key to a node by a lookup table, filled by preference
+// permutations of nodes in turn. It gives O(1) lookup and near perfect
+// balance, at the cost of a little more disruption on membership change.
+// ref: https://research.google/pubs/pub44824/
+type maglev struct {
+	size    uint64
+	weights map[string]int
+	nodes   map[string]edge.Server
+	keyFn   func(key string) string
+
+	table []edge.Server
+	mtx   sync.RWMutex
+}
+
+// NewMaglev creates maglev with lookup table of tableSize entries, which
+// must be a prime, and much larger than node count for good balance.
+// Only WithHashTag and WithKeyExtractor of opts apply.
+func NewMaglev(tableSize int, opts ...Opt) (*maglev, error) {
+	options := newOptions(opts...)
+	if tableSize < minTableSize || !isPrime(tableSize) {
+		return nil, fmt.Errorf("validate prime table size, input:%v", tableSize)
+	}
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &maglev{
+		size:    uint64(tableSize),
+		weights: map[string]int{},
+		nodes:   map[string]edge.Server{},
+		keyFn:   options.keyFnOr(wholeKey),
+		table:   []edge.Server{},
+	}, nil
+}
+
+// Add saves node into hash, node already exists is ignored.
+func (m *maglev) Add(node edge.Server) {
+	_ = m.AddNode(node)
+}
+
+// AddNode saves node, weighted by Weight() if node is edge.WeightedServer.
+func (m *maglev) AddNode(node edge.Server) error {
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	return m.AddWeighted(node, weightOf(node))
+}
+
+// AddWeighted saves node with weight, and rebuilds lookup table.
+func (m *maglev) AddWeighted(node edge.Server, weight int) error {
+	maglevVar.Add.Add(1)
+
+	switch {
+	case unnamed(node):
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+	name := idOf(node)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.nodes[name]; exist {
+		return ErrNodeExists
+	}
+	if uint64(len(m.nodes)) >= m.size {
+		return ErrTableFull
+	}
+	m.nodes[name] = node
+	m.weights[name] = weight
+	m.populate()
+	return nil
+}
+
+// SetWeight changes weight of node, and rebuilds lookup table.
+func (m *maglev) SetWeight(node edge.Server, weight int) error {
+	switch {
+	case node == nil:
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+	name := idOf(node)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.nodes[name]; !exist {
+		return ErrNodeNotFound
+	}
+	m.weights[name] = weight
+	m.populate()
+	return nil
+}
+
+// Remove deletes node from hash, node not exists is ignored.
+func (m *maglev) Remove(node edge.Server) {
+	_ = m.RemoveNode(node)
+}
+
+// RemoveNode deletes node, and rebuilds lookup table.
+func (m *maglev) RemoveNode(node edge.Server) error {
+	maglevVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.nodes[name]; !exist {
+		return ErrNodeNotFound
+	}
+	delete(m.nodes, name)
+	delete(m.weights, name)
+	m.populate()
+	return nil
+}
+
+func (m *maglev) Get(key string) edge.Server {
+	maglevVar.Get.Add(1)
+
+	h := hash64(m.keyFn(key))
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if len(m.table) == 0 {
+		return nil
+	}
+	return m.table[h%m.size]
+}
+
+// populate fills the lookup table, every node in turn takes weight
+// entries following its own permutation, skipping entries taken.
+func (m *maglev) populate() {
+	if len(m.nodes) == 0 {
+		m.table = []edge.Server{}
+		return
+	}
+
+	names := make([]string, 0, len(m.nodes))
+	for name := range m.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	offsets := make([]uint64, len(names))
+	skips := make([]uint64, len(names))
+	next := make([]uint64, len(names))
+	for i, name := range names {
+		h := hash64(name)
+		offsets[i] = h % m.size
+		skips[i] = mix64(h)%(m.size-1) + 1
+	}
+
+	table := make([]edge.Server, m.size)
+	filled := uint64(0)
+	for {
+		for i, name := range names {
+			for turn := 0; turn < m.weights[name]; turn++ {
+				c := (offsets[i] + next[i]*skips[i]) % m.size
+				for table[c] != nil {
+					next[i]++
+					c = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[c] = m.nodes[name]
+				next[i]++
+				filled++
+				if filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+func TestNewMaglev(t *testing.T) {
+	tests := []struct {
+		size    int
+		wantErr bool
+	}{
+		{0, true},
+		{1, true},
+		{65536, true},
+		{2, false},
+		{65537, false},
+	}
+	for _, tt := range tests {
+		if _, err := NewMaglev(tt.size); (err != nil) != tt.wantErr {
+			t.Errorf("NewMaglev(%v) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+		}
+	}
+
+	m, _ := NewMaglev(2)
+	m.Add(testNodeData["testNode1"])
+	m.Add(testNodeData["testNode2"])
+	if err := m.AddNode(testNodeData["testNode3"]); err != ErrTableFull {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrTableFull)
+	}
+}
+
+func Test_maglev_Balance(t *testing.T) {
+	m, _ := NewMaglev(65537)
+	if got := m.Get("key"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	for i := 0; i < 10; i++ {
+		m.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+	if err := m.AddNode(testNode{val: "node-0"}); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+
+	entries := map[edge.Server]int{}
+	for _, each := range m.table {
+		entries[each]++
+	}
+	for node, count := range entries {
+		if math.Abs(float64(count)/6553.7-1) > 0.01 {
+			t.Fatalf("node %v got %v entries, want about 6553", node, count)
+		}
+	}
+
+	before := map[string]edge.Server{}
+	for i := 0; i < 10000; i++ {
+		before[strconv.Itoa(i)] = m.Get(strconv.Itoa(i))
+	}
+	removed := testNode{val: "node-3"}
+	if err := m.RemoveNode(removed); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	moved := 0
+	for key, node := range before {
+		if got := m.Get(key); got != node {
+			if got == removed {
+				t.Fatalf("key %v moved to removed node", key)
+			}
+			moved++
+		}
+	}
+	// keys of the removed node, plus a little disruption
+	if got := float64(moved) / 10000; got < 0.09 || got > 0.15 {
+		t.Fatalf("moved %v of keys, want about 1/10", got)
+	}
+}
+
+func Test_maglev_Weighted(t *testing.T) {
+	m, _ := NewMaglev(65537)
+	small := testNode{val: "small"}
+	large := weightedNode{testNode{val: "large"}, 3}
+	m.Add(small)
+	m.Add(large)
+
+	share := func() float64 {
+		count := 0
+		for _, each := range m.table {
+			if each == large {
+				count++
+			}
+		}
+		return float64(count) / float64(len(m.table))
+	}
+	if got := share(); math.Abs(got-0.75) > 0.01 {
+		t.Fatalf("weighted share = %v, want 0.75", got)
+	}
+	if err := m.SetWeight(large, 1); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	if got := share(); math.Abs(got-0.5) > 0.01 {
+		t.Fatalf("weighted share = %v, want 0.5", got)
+	}
+	if err := m.SetWeight(testNode{val: "unknown"}, 1); err != ErrNodeNotFound {
+		t.Fatalf("SetWeight() error = %v, want %v", err, ErrNodeNotFound)
+	}
+}
@@ -0,0 +1,135 @@
+package hash
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+var _ edge.ConsistentHash = &multiProbe{}
+
+// multiProbe places one point per node, and hashes key with several
+// probes, the node whose point is closest clockwise to any probe wins.
+// 21 probes gives about 1.05 peak to mean load, with no vnode at all.
+// ref: https://arxiv.org/abs/1505.00062
+type multiProbe struct {
+	probes int
+	points []point
+	nodes  map[string]edge.Server
+	keyFn  func(key string) string
+	mtx    sync.RWMutex
+}
+
+type point struct {
+	hash uint64
+	node edge.Server
+}
+
+// NewMultiProbe creates multiProbe hashing key with probes, only
+// WithHashTag and WithKeyExtractor of opts apply.
+func NewMultiProbe(probes int, opts ...Opt) (*multiProbe, error) {
+	options := newOptions(opts...)
+	if probes < minProbes {
+		return nil, fmt.Errorf("min validate probes:%v, input:%v", minProbes, probes)
+	}
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &multiProbe{
+		probes: probes,
+		points: []point{},
+		nodes:  map[string]edge.Server{},
+		keyFn:  options.keyFnOr(wholeKey),
+	}, nil
+}
+
+// Add saves node into hash, node already exists is ignored.
+func (m *multiProbe) Add(node edge.Server) {
+	_ = m.AddNode(node)
+}
+
+// AddNode saves the point of node.
+func (m *multiProbe) AddNode(node edge.Server) error {
+	multiProbeVar.Add.Add(1)
+
+	if unnamed(node) {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+	p := point{mix64(hash64(name)), node}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.nodes[name]; exist {
+		return ErrNodeExists
+	}
+	m.nodes[name] = node
+	// points colliding are ordered by name, the smaller one owns the point
+	idx := sort.Search(len(m.points), func(i int) bool { return !m.points[i].less(p) })
+	m.points = append(m.points, point{})
+	copy(m.points[idx+1:], m.points[idx:])
+	m.points[idx] = p
+	return nil
+}
+
+// Remove deletes node from hash, node not exists is ignored.
+func (m *multiProbe) Remove(node edge.Server) {
+	_ = m.RemoveNode(node)
+}
+
+// RemoveNode deletes the point of node.
+func (m *multiProbe) RemoveNode(node edge.Server) error {
+	multiProbeVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+	p := point{mix64(hash64(name)), node}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.nodes[name]; !exist {
+		return ErrNodeNotFound
+	}
+	delete(m.nodes, name)
+	idx := sort.Search(len(m.points), func(i int) bool { return !m.points[i].less(p) })
+	m.points = append(m.points[:idx], m.points[idx+1:]...)
+	return nil
+}
+
+func (m *multiProbe) Get(key string) edge.Server {
+	multiProbeVar.Get.Add(1)
+
+	h := hash64(m.keyFn(key))
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if len(m.points) == 0 {
+		return nil
+	}
+
+	var best edge.Server
+	bestDistance := ^uint64(0)
+	for i := 0; i < m.probes; i++ {
+		probe := mix64(h + uint64(i)*0x9e3779b97f4a7c15)
+		idx := sort.Search(len(m.points), func(j int) bool { return m.points[j].hash >= probe })
+
+		// Means we have cycled back to the first point.
+		if idx == len(m.points) {
+			idx = 0
+		}
+		if distance := m.points[idx].hash - probe; distance < bestDistance || best == nil {
+			best, bestDistance = m.points[idx].node, distance
+		}
+	}
+	return best
+}
+
+func (p point) less(o point) bool {
+	if p.hash != o.hash {
+		return p.hash < o.hash
+	}
+	return idOf(p.node) < idOf(o.node)
+}
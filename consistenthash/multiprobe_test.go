@@ -0,0 +1,70 @@
+package hash
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+func Test_multiProbe_AddRemove(t *testing.T) {
+	if _, err := NewMultiProbe(0); err == nil {
+		t.Fatalf("NewMultiProbe(0) expected error")
+	}
+	m, _ := NewMultiProbe(21)
+	if got := m.Get("key"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := m.AddNode(testNodeData[fmt.Sprintf("testNode%d", i)]); err != nil {
+			t.Fatalf("AddNode() error = %v", err)
+		}
+	}
+	if err := m.AddNode(testNodeData["testNode1"]); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+	if len(m.points) != 5 {
+		t.Fatalf("points = %v, want one point per node", len(m.points))
+	}
+
+	before := map[string]edge.Server{}
+	for i := 0; i < 10000; i++ {
+		before[strconv.Itoa(i)] = m.Get(strconv.Itoa(i))
+	}
+	removed := testNodeData["testNode2"]
+	if err := m.RemoveNode(removed); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	if err := m.RemoveNode(removed); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	for key, node := range before {
+		if got := m.Get(key); node != removed && got != node {
+			t.Fatalf("key %v moved from %v to %v, want only keys of removed node", key, node, got)
+		}
+	}
+}
+
+func Test_multiProbe_Balance(t *testing.T) {
+	m, _ := NewMultiProbe(21)
+	nodeCnt := 20
+	for i := 0; i < nodeCnt; i++ {
+		m.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+
+	keyCnt := 200000
+	counts := map[edge.Server]int{}
+	for i := 0; i < keyCnt; i++ {
+		counts[m.Get(strconv.Itoa(i))]++
+	}
+	peak := 0
+	for _, count := range counts {
+		if count > peak {
+			peak = count
+		}
+	}
+	if ratio := float64(peak) / (float64(keyCnt) / float64(nodeCnt)); ratio > 1.15 {
+		t.Fatalf("peak to mean ratio = %v, want <= 1.15", ratio)
+	}
+}
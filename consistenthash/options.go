@@ -0,0 +1,117 @@
+package hash
+
+import (
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+type options struct {
+	loadFactor float64
+	hashFn     HashFunc
+	hashBits   int
+	keyFn      func(key string) string
+	domains    []string
+
+	ejectErrors int
+	ejectBase   time.Duration
+	ejectMax    time.Duration
+
+	// ringOnly is set by options only the ring supports
+	ringOnly bool
+}
+
+// Opt configures a consistent hash. WithHashTag and WithKeyExtractor apply
+// to all, the others only to the ring, and other constructors reject them
+// with ErrOptionUnsupported.
+type Opt func(*options)
+
+func newOptions(opts ...Opt) *options {
+	options := &options{
+		hashFn:   FNV32a,
+		hashBits: 32,
+		domains:  []string{edge.LabelZone, edge.LabelRack, edge.LabelHost},
+	}
+	for _, each := range opts {
+		each(options)
+	}
+	return options
+}
+
+// WithBoundedLoad caps the load of every node at (1+epsilon) times of the
+// average load, tracked by Acquire and Release.
+// ref: https://arxiv.org/abs/1608.01350
+func WithBoundedLoad(epsilon float64) Opt {
+	return func(o *options) {
+		o.loadFactor = epsilon
+		o.ringOnly = true
+	}
+}
+
+// WithHashFunc sets the function hashing keys and vnodes, whose positions
+// are below 2^bits, FNV32a of 32 bits by default, which places keys as rings
+// before 64-bit positions did. XXHash64 of 64 bits spreads vnodes better,
+// but remaps keys of an existing ring.
+func WithHashFunc(fn HashFunc, bits int) Opt {
+	return func(o *options) {
+		o.hashFn = fn
+		o.hashBits = bits
+		o.ringOnly = true
+	}
+}
+
+// WithOutlierEjection marks a node of ring down once it reports
+// consecutive errors by ReportError, for base at first, and doubled on
+// each ejection in a row up to max.
+func WithOutlierEjection(consecutive int, base, max time.Duration) Opt {
+	return func(o *options) {
+		o.ejectErrors = consecutive
+		o.ejectBase = base
+		o.ejectMax = max
+		o.ringOnly = true
+	}
+}
+
+// WithFailureDomains sets labels of failure domains GetNSpread spreads
+// replicas over, from the widest, zone, rack and host by default.
+func WithFailureDomains(labels ...string) Opt {
+	return func(o *options) {
+		o.domains = labels
+		o.ringOnly = true
+	}
+}
+
+// WithHashTag hashes only the substring between the first "{" and the
+// first "}" after it, if it is not empty, so that keys sharing the tag like
+// "{user1000}.following" and "{user1000}.followers" land on the same node.
+func WithHashTag() Opt {
+	return WithKeyExtractor(hashTag)
+}
+
+// WithKeyExtractor hashes the part of key returned by fn, instead of the
+// whole key.
+func WithKeyExtractor(fn func(key string) string) Opt {
+	return func(o *options) {
+		o.keyFn = fn
+	}
+}
+
+// keyOnly returns ErrOptionUnsupported if an option only the ring supports is set.
+func (o *options) keyOnly() error {
+	if o.ringOnly {
+		return ErrOptionUnsupported
+	}
+	return nil
+}
+
+// keyFnOr returns the key extractor of options, def if it is not set.
+func (o *options) keyFnOr(def func(key string) string) func(key string) string {
+	if o.keyFn == nil {
+		return def
+	}
+	return o.keyFn
+}
+
+func wholeKey(key string) string {
+	return key
+}
@@ -0,0 +1,133 @@
+package hash
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+func TestWithHashTag(t *testing.T) {
+	userOf := func(key string) string {
+		return strings.SplitN(key, ":", 2)[0]
+	}
+	build := map[string]func(opts ...Opt) edge.ConsistentHash{
+		"ring": func(opts ...Opt) edge.ConsistentHash {
+			r, _ := NewRing(50, opts...)
+			return r
+		},
+		"jump": func(opts ...Opt) edge.ConsistentHash {
+			j, _ := NewJump(opts...)
+			return j
+		},
+		"rendezvous": func(opts ...Opt) edge.ConsistentHash {
+			r, _ := NewRendezvous(opts...)
+			return r
+		},
+		"maglev": func(opts ...Opt) edge.ConsistentHash {
+			m, _ := NewMaglev(65537, opts...)
+			return m
+		},
+		"multiprobe": func(opts ...Opt) edge.ConsistentHash {
+			m, _ := NewMultiProbe(21, opts...)
+			return m
+		},
+		"ketama": func(opts ...Opt) edge.ConsistentHash {
+			k, _ := NewKetama(opts...)
+			return k
+		},
+	}
+	tests := []struct {
+		name   string
+		opt    Opt
+		keysOf func(user int) []string
+	}{
+		{"hash tag", WithHashTag(), func(user int) []string {
+			return []string{fmt.Sprintf("{user%d}.followers", user), fmt.Sprintf("{user%d}.following", user), fmt.Sprintf("order.{user%d}", user)}
+		}},
+		{"key extractor", WithKeyExtractor(userOf), func(user int) []string {
+			return []string{fmt.Sprintf("user%d:followers", user), fmt.Sprintf("user%d:following", user), fmt.Sprintf("user%d", user)}
+		}},
+	}
+	for name, fn := range build {
+		for _, tt := range tests {
+			t.Run(name+" "+tt.name, func(t *testing.T) {
+				h := fn(tt.opt)
+				for i := 0; i < 10; i++ {
+					h.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+				}
+				spread := map[edge.Server]bool{}
+				for user := 0; user < 100; user++ {
+					keys := tt.keysOf(user)
+					want := h.Get(keys[0])
+					for _, key := range keys[1:] {
+						if got := h.Get(key); got != want {
+							t.Fatalf("Get(%v) = %v, want %v as %v", key, got, want, keys[0])
+						}
+					}
+					spread[want] = true
+				}
+				if len(spread) < 5 {
+					t.Fatalf("users spread over %v nodes, want most of 10", len(spread))
+				}
+			})
+		}
+	}
+
+	s, _ := NewSlots(WithKeyExtractor(userOf))
+	s.Add(testNode{val: "a"})
+	_ = s.Assign(0, SlotCount-1, testNode{val: "a"})
+	if got := s.Get("user1:followers"); got == nil {
+		t.Fatalf("slots Get() = nil, want assigned node")
+	}
+	if slotOf(s.keyFn("user1:followers")) != Slot("user1") {
+		t.Fatalf("slots extractor not applied")
+	}
+}
+
+func TestOptionsUnsupported(t *testing.T) {
+	build := map[string]func(opts ...Opt) error{
+		"jump": func(opts ...Opt) error {
+			_, err := NewJump(opts...)
+			return err
+		},
+		"rendezvous": func(opts ...Opt) error {
+			_, err := NewRendezvous(opts...)
+			return err
+		},
+		"maglev": func(opts ...Opt) error {
+			_, err := NewMaglev(65537, opts...)
+			return err
+		},
+		"multiprobe": func(opts ...Opt) error {
+			_, err := NewMultiProbe(21, opts...)
+			return err
+		},
+		"ketama": func(opts ...Opt) error {
+			_, err := NewKetama(opts...)
+			return err
+		},
+		"slots": func(opts ...Opt) error {
+			_, err := NewSlots(opts...)
+			return err
+		},
+	}
+	ringOnly := map[string]Opt{
+		"bounded load":     WithBoundedLoad(0.25),
+		"hash func":        WithHashFunc(XXHash64, 64),
+		"outlier ejection": WithOutlierEjection(3, time.Second, time.Minute),
+		"failure domains":  WithFailureDomains(edge.LabelZone),
+	}
+	for name, fn := range build {
+		if err := fn(WithHashTag(), WithKeyExtractor(wholeKey)); err != nil {
+			t.Fatalf("%v with key options err = %v", name, err)
+		}
+		for opt, each := range ringOnly {
+			if err := fn(WithHashTag(), each); err != ErrOptionUnsupported {
+				t.Fatalf("%v with %v err = %v, want %v", name, opt, err, ErrOptionUnsupported)
+			}
+		}
+	}
+}
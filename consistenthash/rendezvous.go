@@ -0,0 +1,189 @@
+package hash
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+var _ edge.ConsistentHash = &rendezvous{}
+
+// rendezvous maps key to the node of highest random weight, scored by
+// hash of node and key. Removing a node moves only its own keys.
+// Weighted scoring uses the logarithmic method, score = -weight/ln(u).
+// ref: https://en.wikipedia.org/wiki/Rendezvous_hashing
+type rendezvous struct {
+	nodes []candidate
+	index map[string]int
+	keyFn func(key string) string
+	mtx   sync.RWMutex
+}
+
+type candidate struct {
+	node   edge.Server
+	seed   uint64
+	weight float64
+}
+
+// NewRendezvous creates rendezvous, only WithHashTag and WithKeyExtractor
+// of opts apply.
+func NewRendezvous(opts ...Opt) (*rendezvous, error) {
+	options := newOptions(opts...)
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &rendezvous{
+		nodes: []candidate{},
+		index: map[string]int{},
+		keyFn: options.keyFnOr(wholeKey),
+	}, nil
+}
+
+// Add saves node into hash, node already exists is ignored.
+func (r *rendezvous) Add(node edge.Server) {
+	_ = r.AddNode(node)
+}
+
+// AddNode saves node, weighted by Weight() if node is edge.WeightedServer.
+func (r *rendezvous) AddNode(node edge.Server) error {
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	return r.AddWeighted(node, weightOf(node))
+}
+
+// AddWeighted saves node with weight.
+func (r *rendezvous) AddWeighted(node edge.Server, weight int) error {
+	rendezvousVar.Add.Add(1)
+
+	switch {
+	case unnamed(node):
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+	name := idOf(node)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, exist := r.index[name]; exist {
+		return ErrNodeExists
+	}
+	r.index[name] = len(r.nodes)
+	r.nodes = append(r.nodes, candidate{node, hash64(name), float64(weight)})
+	return nil
+}
+
+// SetWeight changes weight of node.
+func (r *rendezvous) SetWeight(node edge.Server, weight int) error {
+	switch {
+	case node == nil:
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	idx, exist := r.index[idOf(node)]
+	if !exist {
+		return ErrNodeNotFound
+	}
+	r.nodes[idx].weight = float64(weight)
+	return nil
+}
+
+// Remove deletes node from hash, node not exists is ignored.
+func (r *rendezvous) Remove(node edge.Server) {
+	_ = r.RemoveNode(node)
+}
+
+// RemoveNode deletes node from hash.
+func (r *rendezvous) RemoveNode(node edge.Server) error {
+	rendezvousVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	idx, exist := r.index[name]
+	if !exist {
+		return ErrNodeNotFound
+	}
+	last := len(r.nodes) - 1
+	r.nodes[idx] = r.nodes[last]
+	r.index[idOf(r.nodes[idx].node)] = idx
+	r.nodes[last] = candidate{}
+	r.nodes = r.nodes[:last]
+	delete(r.index, name)
+	return nil
+}
+
+func (r *rendezvous) Get(key string) edge.Server {
+	rendezvousVar.Get.Add(1)
+
+	h := hash64(r.keyFn(key))
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var best edge.Server
+	bestScore := math.Inf(-1)
+	for _, each := range r.nodes {
+		if s := score(h, each); s > bestScore {
+			best, bestScore = each.node, s
+		}
+	}
+	return best
+}
+
+// GetN returns up to n nodes of highest scores for key, in descending order.
+func (r *rendezvous) GetN(key string, n int) []edge.Server {
+	rendezvousVar.Get.Add(1)
+
+	h := hash64(r.keyFn(key))
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	type scored struct {
+		node  edge.Server
+		score float64
+	}
+	all := make([]scored, len(r.nodes))
+	for i, each := range r.nodes {
+		all[i] = scored{each.node, score(h, each)}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+
+	nodes := make([]edge.Server, n)
+	for i := range nodes {
+		nodes[i] = all[i].node
+	}
+	return nodes
+}
+
+// score returns -weight/ln(u), u is uniform in (0, 1) by key and node.
+func score(key uint64, c candidate) float64 {
+	u := (float64(mix64(key^c.seed)>>11) + 0.5) / (1 << 53)
+	return -c.weight / math.Log(u)
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
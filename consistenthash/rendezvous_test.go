@@ -0,0 +1,104 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/cyningsun/edge"
+)
+
+func Test_rendezvous_AddRemove(t *testing.T) {
+	r, _ := NewRendezvous()
+	if got := r.Get("key"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := r.AddNode(testNodeData[fmt.Sprintf("testNode%d", i)]); err != nil {
+			t.Fatalf("AddNode() error = %v", err)
+		}
+	}
+	if err := r.AddNode(testNodeData["testNode1"]); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+	if err := r.AddWeighted(testNode{val: "zero"}, 0); err != ErrWeightInvalid {
+		t.Fatalf("AddWeighted() error = %v, want %v", err, ErrWeightInvalid)
+	}
+
+	before := map[string]edge.Server{}
+	counts := map[edge.Server]int{}
+	for i := 0; i < 50000; i++ {
+		node := r.Get(strconv.Itoa(i))
+		before[strconv.Itoa(i)] = node
+		counts[node]++
+	}
+	for node, count := range counts {
+		if math.Abs(float64(count)/10000-1) > 0.05 {
+			t.Fatalf("node %v got %v keys, want about 10000", node, count)
+		}
+	}
+
+	removed := testNodeData["testNode3"]
+	if err := r.RemoveNode(removed); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	if err := r.RemoveNode(removed); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	for key, node := range before {
+		if got := r.Get(key); node != removed && got != node {
+			t.Fatalf("key %v moved from %v to %v, want only keys of removed node", key, node, got)
+		}
+	}
+}
+
+func Test_rendezvous_Weighted(t *testing.T) {
+	r, _ := NewRendezvous()
+	small := testNode{val: "small"}
+	large := weightedNode{testNode{val: "large"}, 3}
+	r.Add(small)
+	r.Add(large)
+
+	share := func() float64 {
+		hits := 0
+		for i := 0; i < 100000; i++ {
+			if r.Get(strconv.Itoa(i)) == large {
+				hits++
+			}
+		}
+		return float64(hits) / 100000
+	}
+	if got := share(); math.Abs(got-0.75) > 0.02 {
+		t.Fatalf("weighted share = %v, want 0.75", got)
+	}
+	if err := r.SetWeight(large, 1); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	if got := share(); math.Abs(got-0.5) > 0.02 {
+		t.Fatalf("weighted share = %v, want 0.5", got)
+	}
+}
+
+func Test_rendezvous_GetN(t *testing.T) {
+	r, _ := NewRendezvous()
+	if got := r.GetN("key", 2); got != nil {
+		t.Fatalf("GetN() on empty = %v, want nil", got)
+	}
+	for i := 1; i <= 5; i++ {
+		r.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		got := r.GetN(key, 3)
+		if len(got) != 3 || got[0] != r.Get(key) {
+			t.Fatalf("GetN(%v) = %v, want 3 nodes starting with %v", key, got, r.Get(key))
+		}
+		if got[0] == got[1] || got[0] == got[2] || got[1] == got[2] {
+			t.Fatalf("GetN(%v) = %v, want distinct nodes", key, got)
+		}
+	}
+	if got := r.GetN("key", 10); len(got) != 5 {
+		t.Fatalf("GetN() = %v, want all 5 nodes", got)
+	}
+}
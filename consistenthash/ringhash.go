@@ -1,113 +1,701 @@
 package hash
 
 import (
+	"errors"
 	"fmt"
-	"hash/fnv"
+	"math"
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cyningsun/edge"
 )
 
 var _ edge.ConsistentHash = &ring{}
 
+// ring is read lock free. Writers serialize on mtx, change the nodes and
+// vnodes, then publish an immutable table of the ring for readers.
 type ring struct {
 	replicas int
+	hashFn   HashFunc
+	hashBits uint
+	keyFn    func(key string) string
+	domains  []string
+	table    atomic.Value // *table
 
-	vnodes map[uint32]edge.Server
-	sorted []uint32
-	mtx    sync.Mutex
+	nodes   map[string]edge.Server
+	weights map[string]int
+	vnodes  map[uint64]edge.Server
+	// shadowed keeps nodes whose vnode collides with the owner in vnodes,
+	// the vnode passes to one of them once the owner is removed.
+	shadowed map[uint64][]edge.Server
+	sorted   []uint64
+	mtx      sync.Mutex
+
+	// load is nil unless bounded load mode
+	load *loads
+
+	// down keeps nodes Get skips until the time, outliers is nil unless
+	// outlier ejection
+	down     map[string]time.Time
+	upTimers map[string]*time.Timer
+	outliers *outliers
+
+	version     uint64
+	seq         uint64
+	subscribers map[*subscriber]struct{}
+}
+
+// table is the snapshot of ring readers look up, it never changes once published.
+type table struct {
+	hashes []uint64
+	owners []edge.Server
+	// members is sorted by name
+	members []member
+	down    map[string]time.Time
+	// domains is failure domains of labeled nodes by name
+	domains map[string][]string
+}
+
+type member struct {
+	node   edge.Server
+	weight int
+}
+
+var emptyTable = &table{}
+
+// loads tracks keys assigned to each node in bounded load mode.
+type loads struct {
+	epsilon float64
+	nodes   map[string]int64
+	total   int64
 }
 
-func NewRing(replicas int) (*ring, error) {
-	if replicas < minReplicas {
+// NewRing creates a ring of replicas vnodes per node weight, hashing by
+// FNV32a unless WithHashFunc of opts sets another.
+func NewRing(replicas int, opts ...Opt) (*ring, error) {
+	options := newOptions(opts...)
+	switch {
+	case replicas < minReplicas:
 		return nil, fmt.Errorf("min validate replicas:%v, input:%v", minReplicas, replicas)
+	case options.loadFactor < 0:
+		return nil, fmt.Errorf("min validate load factor:0, input:%v", options.loadFactor)
+	case options.hashFn == nil || options.hashBits < 1 || options.hashBits > 64:
+		return nil, errors.New("hash func invalid")
+	case options.ejectErrors < 0 || (options.ejectErrors > 0 && (options.ejectBase <= 0 || options.ejectMax < options.ejectBase)):
+		return nil, errors.New("outlier ejection invalid")
 	}
-	return &ring{
+
+	r := &ring{
 		replicas: replicas,
-		vnodes:   map[uint32]edge.Server{},
-		sorted:   []uint32{},
-	}, nil
+		hashFn:   options.hashFn,
+		hashBits: uint(options.hashBits),
+		keyFn:    options.keyFnOr(wholeKey),
+		domains:  options.domains,
+		nodes:    map[string]edge.Server{},
+		weights:  map[string]int{},
+		vnodes:   map[uint64]edge.Server{},
+		shadowed: map[uint64][]edge.Server{},
+		sorted:   []uint64{},
+		down:     map[string]time.Time{},
+		upTimers: map[string]*time.Timer{},
+
+		subscribers: map[*subscriber]struct{}{},
+	}
+	if options.ejectErrors > 0 {
+		r.outliers = &outliers{
+			consecutive: options.ejectErrors,
+			base:        options.ejectBase,
+			max:         options.ejectMax,
+			nodes:       map[string]*outlier{},
+		}
+	}
+	if options.loadFactor > 0 {
+		r.load = &loads{
+			epsilon: options.loadFactor,
+			nodes:   map[string]int64{},
+		}
+	}
+	r.publish()
+	return r, nil
 }
 
+// Add saves node into ring, node already exists is ignored.
 func (r *ring) Add(node edge.Server) {
+	_ = r.AddNode(node)
+}
+
+// AddNode saves all vnodes of node into ring, or nothing if it fails.
+// Vnodes are named by ID() if node is edge.Node, otherwise String(), in
+// one namespace, and an empty ID() is invalid.
+// A vnode colliding with vnode of another node is owned by the node with
+// smaller name, so the ring is the same whatever order nodes are added.
+// If node is edge.WeightedServer, it has replicas*Weight() vnodes.
+func (r *ring) AddNode(node edge.Server) error {
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	return r.AddWeighted(node, weightOf(node))
+}
+
+// AddWeighted saves node with replicas*weight vnodes into ring.
+func (r *ring) AddWeighted(node edge.Server, weight int) error {
 	ringVar.Add.Add(1)
 
-	newHash := make([]uint32, 0, r.replicas)
-	for i := 1; i <= r.replicas; i++ {
-		h := hash(node.String() + "_" + strconv.Itoa(i))
-		newHash = append(newHash, h)
+	switch {
+	case unnamed(node):
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
 	}
+	name := idOf(node)
+	newHash := r.vnodeHashes(name, weight)
 
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	for i := 1; i <= r.replicas; i++ {
-		h := newHash[i-1]
-		// skip already exist node
-		if r.contains(h) {
-			return
-		}
+	if _, exist := r.nodes[name]; exist {
+		return ErrNodeExists
+	}
+
+	r.nodes[name] = node
+	r.weights[name] = weight
+	r.addVnodes(node, newHash)
+	r.publish()
+	r.notify(MembershipEvent{Type: NodeAdded, Node: node, Weight: weight})
+	return nil
+}
 
-		r.sorted = append(r.sorted, h)
-		r.vnodes[h] = node
+// SetWeight changes weight of node in place, only vnodes added or
+// removed for the difference move their keys.
+func (r *ring) SetWeight(node edge.Server, weight int) error {
+	switch {
+	case node == nil:
+		return ErrNodeInvalid
+	case weight < minWeight:
+		return ErrWeightInvalid
 	}
-	sort.Slice(r.sorted, func(i, j int) bool { return r.sorted[i] < r.sorted[j] })
+	name := idOf(node)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	old, exist := r.weights[name]
+	if !exist {
+		return ErrNodeNotFound
+	}
+	if old == weight {
+		return nil
+	}
+
+	oldHash := r.vnodeHashes(name, old)
+	newHash := r.vnodeHashes(name, weight)
+	r.weights[name] = weight
+	if weight > old {
+		r.addVnodes(r.nodes[name], difference(newHash, oldHash))
+	} else {
+		r.removeVnodes(name, difference(oldHash, newHash))
+	}
+	r.publish()
+	r.notify(MembershipEvent{Type: WeightChanged, Node: r.nodes[name], Weight: weight})
+	return nil
 }
 
-func (r *ring) contains(h uint32) bool {
+// Weight returns weight of node, 0 if node not exists.
+func (r *ring) Weight(node edge.Server) int {
+	if node == nil {
+		return 0
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.weights[idOf(node)]
+}
+
+func (r *ring) contains(h uint64) bool {
 	if _, exist := r.vnodes[h]; exist {
 		return true
 	}
 	return false
 }
 
+// Remove deletes node from ring, node not exists is ignored.
 func (r *ring) Remove(node edge.Server) {
+	_ = r.RemoveNode(node)
+}
+
+// RemoveNode deletes all vnodes of node from ring, or nothing if it fails.
+func (r *ring) RemoveNode(node edge.Server) error {
 	ringVar.Remove.Add(1)
 
-	newHash := make([]uint32, 0, r.replicas)
-	for i := 1; i <= r.replicas; i++ {
-		h := hash(node.String() + "_" + strconv.Itoa(i))
-		newHash = append(newHash, h)
+	if node == nil {
+		return ErrNodeInvalid
 	}
+	name := idOf(node)
 
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
-	for i := 1; i <= r.replicas; i++ {
-		h := newHash[i-1]
-		// skip not exist node
-		if !r.contains(h) {
-			return
+	weight, exist := r.weights[name]
+	if !exist {
+		return ErrNodeNotFound
+	}
+
+	r.removeVnodes(name, r.vnodeHashes(name, weight))
+	removed := r.nodes[name]
+	delete(r.nodes, name)
+	delete(r.weights, name)
+	if r.load != nil {
+		r.load.total -= r.load.nodes[name]
+		delete(r.load.nodes, name)
+	}
+	r.forget(name)
+	r.publish()
+	r.notify(MembershipEvent{Type: NodeRemoved, Node: removed})
+	return nil
+}
+
+// SetMembers replaces members of ring with nodes, saving nodes not in ring,
+// deleting members not in nodes, and changing weights of the others, all
+// in one rebuild, so readers never see the ring half updated. Members kept
+// are replaced by the nodes of the same name, which may carry a new address
+// or labels. It returns nodes added and removed, or changes nothing if it
+// fails.
+func (r *ring) SetMembers(nodes []edge.Server) (added, removed []edge.Server, err error) {
+	ringVar.Set.Add(1)
+
+	members := make(map[string]edge.Server, len(nodes))
+	for _, node := range nodes {
+		switch {
+		case unnamed(node):
+			return nil, nil, ErrNodeInvalid
+		case weightOf(node) < minWeight:
+			return nil, nil, ErrWeightInvalid
+		}
+		if _, dup := members[idOf(node)]; dup {
+			return nil, nil, ErrNodeExists
 		}
+		members[idOf(node)] = node
+	}
 
-		idx := sort.Search(len(r.sorted), func(i int) bool { return r.sorted[i] >= h })
-		r.sorted = append(r.sorted[:idx], r.sorted[idx+1:]...)
-		delete(r.vnodes, h)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	var events []MembershipEvent
+	dropped := false
+	for name, node := range r.nodes {
+		if _, keep := members[name]; keep {
+			continue
+		}
+		if r.dropVnodes(name, r.vnodeHashes(name, r.weights[name])) {
+			dropped = true
+		}
+		delete(r.nodes, name)
+		delete(r.weights, name)
+		if r.load != nil {
+			r.load.total -= r.load.nodes[name]
+			delete(r.load.nodes, name)
+		}
+		r.forget(name)
+		removed = append(removed, node)
+		events = append(events, MembershipEvent{Type: NodeRemoved, Node: node})
 	}
-	sort.Slice(r.sorted, func(i, j int) bool { return r.sorted[i] < r.sorted[j] })
+	for name, node := range members {
+		if old, exist := r.weights[name]; exist && weightOf(node) < old {
+			weight := weightOf(node)
+			r.weights[name] = weight
+			if r.dropVnodes(name, difference(r.vnodeHashes(name, old), r.vnodeHashes(name, weight))) {
+				dropped = true
+			}
+			events = append(events, MembershipEvent{Type: WeightChanged, Node: node, Weight: weight})
+		}
+	}
+	// compact before placing, as a dropped vnode may be placed again
+	if dropped {
+		r.compact()
+	}
+
+	for name, node := range members {
+		weight := weightOf(node)
+		old, exist := r.weights[name]
+		if !exist {
+			r.nodes[name] = node
+			r.weights[name] = weight
+			r.placeVnodes(node, r.vnodeHashes(name, weight))
+			added = append(added, node)
+			events = append(events, MembershipEvent{Type: NodeAdded, Node: node, Weight: weight})
+			continue
+		}
+		r.replaceNode(node)
+		if weight > old {
+			r.weights[name] = weight
+			r.placeVnodes(node, difference(r.vnodeHashes(name, weight), r.vnodeHashes(name, old)))
+			events = append(events, MembershipEvent{Type: WeightChanged, Node: node, Weight: weight})
+		}
+	}
+	r.sort()
+	r.publish()
+	r.notify(events...)
+	return added, removed, nil
 }
 
+// Get returns the node of key without locking, except in bounded load mode
+// which reads loads of nodes.
 func (r *ring) Get(key string) edge.Server {
 	ringVar.Get.Add(1)
 
+	h := r.hashFn([]byte(r.keyFn(key)))
+	if r.load != nil {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		return r.lookup(h)
+	}
+
+	t := r.snapshot()
+	if len(t.hashes) == 0 {
+		return nil
+	}
+	return t.healthy(t.search(h))
+}
+
+// Acquire returns the node of key like Get, and counts one more load on it.
+// In bounded load mode, the node must be released by Release once done.
+func (r *ring) Acquire(key string) edge.Server {
+	ringVar.Get.Add(1)
+
+	h := r.hashFn([]byte(r.keyFn(key)))
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 	if len(r.sorted) == 0 {
 		return nil
 	}
-	h := hash(key)
+	node := r.lookup(h)
+	if r.load != nil {
+		r.load.nodes[idOf(node)]++
+		r.load.total++
+	}
+	return node
+}
+
+// Release counts one less load on node acquired by Acquire.
+func (r *ring) Release(node edge.Server) {
+	if node == nil {
+		return
+	}
+
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
+	if r.load == nil {
+		return
+	}
+	name := idOf(node)
+	if r.load.nodes[name] > 0 {
+		r.load.nodes[name]--
+		r.load.total--
+	}
+}
+
+// Load returns load of node counted by Acquire and Release.
+func (r *ring) Load(node edge.Server) int64 {
+	if node == nil {
+		return 0
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.load == nil {
+		return 0
+	}
+	return r.load.nodes[idOf(node)]
+}
+
+// lookup returns the first node up clockwise from h. In bounded load mode,
+// nodes which would exceed their capacity are skipped.
+func (r *ring) lookup(h uint64) edge.Server {
+	if len(r.sorted) == 0 {
+		return nil
+	}
 	idx := sort.Search(len(r.sorted), func(i int) bool { return r.sorted[i] >= h })
 
 	// Means we have cycled back to the first replica.
 	if idx == len(r.sorted) {
 		idx = 0
 	}
+	if r.load == nil && len(r.down) == 0 {
+		return r.vnodes[r.sorted[idx]]
+	}
 
+	totalWeight := 0
+	for _, w := range r.weights {
+		totalWeight += w
+	}
+	now := time.Now()
+	for i := 0; i < len(r.sorted); i++ {
+		node := r.vnodes[r.sorted[(idx+i)%len(r.sorted)]]
+		if until, ok := r.down[idOf(node)]; ok && now.Before(until) {
+			continue
+		}
+		if r.load == nil || r.load.nodes[idOf(node)] < r.capacity(node, totalWeight) {
+			return node
+		}
+	}
 	return r.vnodes[r.sorted[idx]]
 }
 
-func hash(key string) uint32 {
-	h := fnv.New32a()
-	h.Write([]byte(key))
-	return h.Sum32()
+// capacity is ceil((1+ε)·average load), counting the load to assign,
+// and in proportion to weight of node.
+func (r *ring) capacity(node edge.Server, totalWeight int) int64 {
+	share := float64(r.weights[idOf(node)]) / float64(totalWeight)
+	return int64(math.Ceil((1 + r.load.epsilon) * float64(r.load.total+1) * share))
+}
+
+// GetN returns up to n distinct nodes close to key hash, walking clockwise
+// from the key, as the preference list of primary and backups. Nodes down
+// are put after nodes up.
+func (r *ring) GetN(key string, n int) []edge.Server {
+	ringVar.Get.Add(1)
+
+	h := r.hashFn([]byte(r.keyFn(key)))
+	t := r.snapshot()
+	if n > len(t.members) {
+		n = len(t.members)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	nodes := make([]edge.Server, 0, n)
+	var down []edge.Server
+	picked := make(map[string]struct{}, n)
+	idx := t.search(h)
+	now := time.Now()
+	for i := 0; i < len(t.hashes) && len(nodes) < n; i++ {
+		node := t.owners[(idx+i)%len(t.hashes)]
+		if _, dup := picked[idOf(node)]; dup {
+			continue
+		}
+		picked[idOf(node)] = struct{}{}
+		if t.isDown(node, now) {
+			down = append(down, node)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	for _, node := range down {
+		if len(nodes) == n {
+			break
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// snapshot returns the table last published.
+func (r *ring) snapshot() *table {
+	if t, ok := r.table.Load().(*table); ok {
+		return t
+	}
+	return emptyTable
+}
+
+// publish builds a table of the current ring for readers, mtx must be held.
+func (r *ring) publish() {
+	t := &table{
+		hashes:  make([]uint64, len(r.sorted)),
+		owners:  make([]edge.Server, len(r.sorted)),
+		members: make([]member, 0, len(r.nodes)),
+	}
+	copy(t.hashes, r.sorted)
+	for i, h := range t.hashes {
+		t.owners[i] = r.vnodes[h]
+	}
+	for name, node := range r.nodes {
+		t.members = append(t.members, member{node, r.weights[name]})
+	}
+	sort.Slice(t.members, func(i, j int) bool { return idOf(t.members[i].node) < idOf(t.members[j].node) })
+	t.domains = r.failureDomains()
+	t.down = r.downNodes()
+	r.table.Store(t)
+}
+
+// search returns index of the first vnode clockwise from h, t must not be empty.
+func (t *table) search(h uint64) int {
+	idx := sort.Search(len(t.hashes), func(i int) bool { return t.hashes[i] >= h })
+	// Means we have cycled back to the first replica.
+	if idx == len(t.hashes) {
+		idx = 0
+	}
+	return idx
+}
+
+func (r *ring) addVnodes(node edge.Server, hashes []uint64) {
+	r.placeVnodes(node, hashes)
+	r.sort()
+}
+
+// placeVnodes saves vnodes of node, leaving sorted unsorted.
+func (r *ring) placeVnodes(node edge.Server, hashes []uint64) {
+	name := idOf(node)
+	for _, h := range hashes {
+		owner, exist := r.vnodes[h]
+		switch {
+		case !exist:
+			r.vnodes[h] = node
+			r.sorted = append(r.sorted, h)
+		case name < idOf(owner):
+			r.vnodes[h] = node
+			r.shadow(h, owner)
+		default:
+			r.shadow(h, node)
+		}
+	}
+}
+
+func (r *ring) sort() {
+	sort.Slice(r.sorted, func(i, j int) bool { return r.sorted[i] < r.sorted[j] })
+}
+
+func (r *ring) removeVnodes(name string, hashes []uint64) {
+	if r.dropVnodes(name, hashes) {
+		r.compact()
+	}
+}
+
+// dropVnodes deletes vnodes of node name, returning whether any is gone
+// from the ring, and leaving sorted to compact.
+func (r *ring) dropVnodes(name string, hashes []uint64) bool {
+	removed := false
+	for _, h := range hashes {
+		if idOf(r.vnodes[h]) != name {
+			r.unshadow(h, name)
+			continue
+		}
+		if next, ok := r.promote(h); ok {
+			r.vnodes[h] = next
+			continue
+		}
+		delete(r.vnodes, h)
+		removed = true
+	}
+	return removed
+}
+
+// compact drops hashes of deleted vnodes from sorted.
+func (r *ring) compact() {
+	sorted := r.sorted[:0]
+	for _, h := range r.sorted {
+		if r.contains(h) {
+			sorted = append(sorted, h)
+		}
+	}
+	r.sorted = sorted
+}
+
+// vnodeHashes returns distinct hashes of replicas*weight vnodes of node name.
+func (r *ring) vnodeHashes(name string, weight int) []uint64 {
+	count := r.replicas * weight
+	hashes := make([]uint64, 0, count)
+	seen := make(map[uint64]struct{}, count)
+	for i := 1; i <= count; i++ {
+		h := r.hashFn([]byte(name + "_" + strconv.Itoa(i)))
+		if _, dup := seen[h]; dup {
+			continue
+		}
+		seen[h] = struct{}{}
+		hashes = append(hashes, h)
+	}
+	return hashes
+}
+
+// replaceNode makes node own or shadow vnodes of the member of the same
+// name in its place, mtx must be held.
+func (r *ring) replaceNode(node edge.Server) {
+	name := idOf(node)
+	r.nodes[name] = node
+	for _, h := range r.vnodeHashes(name, r.weights[name]) {
+		if idOf(r.vnodes[h]) == name {
+			r.vnodes[h] = node
+			continue
+		}
+		for i, each := range r.shadowed[h] {
+			if idOf(each) == name {
+				r.shadowed[h][i] = node
+			}
+		}
+	}
+}
+
+func (r *ring) shadow(h uint64, node edge.Server) {
+	r.shadowed[h] = append(r.shadowed[h], node)
+}
+
+func (r *ring) unshadow(h uint64, name string) {
+	nodes := r.shadowed[h]
+	for i, each := range nodes {
+		if idOf(each) == name {
+			nodes = append(nodes[:i], nodes[i+1:]...)
+			break
+		}
+	}
+	if len(nodes) == 0 {
+		delete(r.shadowed, h)
+		return
+	}
+	r.shadowed[h] = nodes
+}
+
+// promote takes the shadowed node with smallest name of vnode h.
+func (r *ring) promote(h uint64) (edge.Server, bool) {
+	nodes := r.shadowed[h]
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	min := nodes[0]
+	for _, each := range nodes[1:] {
+		if idOf(each) < idOf(min) {
+			min = each
+		}
+	}
+	r.unshadow(h, idOf(min))
+	return min, true
+}
+
+// idOf returns the key of node in hash, ID() if node is edge.Node, so that
+// changing its String() moves no key. IDs and String() of other nodes share
+// one namespace, a node of ID "a" is the same node as a server named "a".
+func idOf(node edge.Server) string {
+	if n, ok := node.(edge.Node); ok {
+		return n.ID()
+	}
+	return node.String()
+}
+
+// unnamed returns whether node is nil or edge.Node of empty ID.
+func unnamed(node edge.Server) bool {
+	if node == nil {
+		return true
+	}
+	n, ok := node.(edge.Node)
+	return ok && n.ID() == ""
+}
+
+func weightOf(node edge.Server) int {
+	if w, ok := node.(edge.WeightedServer); ok {
+		return w.Weight()
+	}
+	return minWeight
+}
+
+// difference returns hashes in a but not in b.
+func difference(a, b []uint64) []uint64 {
+	in := make(map[uint64]struct{}, len(b))
+	for _, h := range b {
+		in[h] = struct{}{}
+	}
+	diff := make([]uint64, 0, len(a))
+	for _, h := range a {
+		if _, ok := in[h]; !ok {
+			diff = append(diff, h)
+		}
+	}
+	return diff
 }
@@ -3,10 +3,13 @@ package hash
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/cyningsun/edge"
 )
@@ -14,75 +17,113 @@ import (
 var testRingData = map[string]*ring{
 	"zeroNodeRing": {
 		replicas: 2,
-		sorted:   []uint32{},
-		vnodes:   map[uint32]edge.Server{},
+		nodes:    map[string]edge.Server{},
+		weights:  map[string]int{},
+		sorted:   []uint64{},
+		vnodes:   map[uint64]edge.Server{},
+		shadowed: map[uint64][]edge.Server{},
 		mtx:      sync.Mutex{},
 	},
 	"oneNodeRing": {
 		replicas: 2,
-		sorted: sorted([]uint32{
-			hash("testNode1_1"),
-			hash("testNode1_2"),
+		nodes: map[string]edge.Server{
+			"testNode1": testNodeData["testNode1"],
+		},
+		weights: map[string]int{
+			"testNode1": 1,
+		},
+		shadowed: map[uint64][]edge.Server{},
+		sorted: sorted([]uint64{
+			fnv32("testNode1_1"),
+			fnv32("testNode1_2"),
 		}),
-		vnodes: map[uint32]edge.Server{
-			hash("testNode1_1"): testNodeData["testNode1"],
-			hash("testNode1_2"): testNodeData["testNode1"],
+		vnodes: map[uint64]edge.Server{
+			fnv32("testNode1_1"): testNodeData["testNode1"],
+			fnv32("testNode1_2"): testNodeData["testNode1"],
 		},
 		mtx: sync.Mutex{},
 	},
 	"fourNodeRing": {
 		replicas: 2,
-		sorted: sorted([]uint32{
-			hash("testNode1_1"),
-			hash("testNode2_1"),
-			hash("testNode3_1"),
-			hash("testNode4_1"),
-
-			hash("testNode1_2"),
-			hash("testNode2_2"),
-			hash("testNode3_2"),
-			hash("testNode4_2"),
+		nodes: map[string]edge.Server{
+			"testNode1": testNodeData["testNode1"],
+			"testNode2": testNodeData["testNode2"],
+			"testNode3": testNodeData["testNode3"],
+			"testNode4": testNodeData["testNode4"],
+		},
+		weights: map[string]int{
+			"testNode1": 1,
+			"testNode2": 1,
+			"testNode3": 1,
+			"testNode4": 1,
+		},
+		shadowed: map[uint64][]edge.Server{},
+		sorted: sorted([]uint64{
+			fnv32("testNode1_1"),
+			fnv32("testNode2_1"),
+			fnv32("testNode3_1"),
+			fnv32("testNode4_1"),
+
+			fnv32("testNode1_2"),
+			fnv32("testNode2_2"),
+			fnv32("testNode3_2"),
+			fnv32("testNode4_2"),
 		}),
-		vnodes: map[uint32]edge.Server{
-			hash("testNode1_1"): testNodeData["testNode1"],
-			hash("testNode2_1"): testNodeData["testNode2"],
-			hash("testNode3_1"): testNodeData["testNode3"],
-			hash("testNode4_1"): testNodeData["testNode4"],
+		vnodes: map[uint64]edge.Server{
+			fnv32("testNode1_1"): testNodeData["testNode1"],
+			fnv32("testNode2_1"): testNodeData["testNode2"],
+			fnv32("testNode3_1"): testNodeData["testNode3"],
+			fnv32("testNode4_1"): testNodeData["testNode4"],
 
-			hash("testNode1_2"): testNodeData["testNode1"],
-			hash("testNode2_2"): testNodeData["testNode2"],
-			hash("testNode3_2"): testNodeData["testNode3"],
-			hash("testNode4_2"): testNodeData["testNode4"],
+			fnv32("testNode1_2"): testNodeData["testNode1"],
+			fnv32("testNode2_2"): testNodeData["testNode2"],
+			fnv32("testNode3_2"): testNodeData["testNode3"],
+			fnv32("testNode4_2"): testNodeData["testNode4"],
 		},
 		mtx: sync.Mutex{},
 	},
 	"fiveNodeRing": {
 		replicas: 2,
-		sorted: sorted([]uint32{
-			hash("testNode1_1"),
-			hash("testNode2_1"),
-			hash("testNode3_1"),
-			hash("testNode4_1"),
-			hash("testNode5_1"),
-
-			hash("testNode1_2"),
-			hash("testNode2_2"),
-			hash("testNode3_2"),
-			hash("testNode4_2"),
-			hash("testNode5_2"),
+		nodes: map[string]edge.Server{
+			"testNode1": testNodeData["testNode1"],
+			"testNode2": testNodeData["testNode2"],
+			"testNode3": testNodeData["testNode3"],
+			"testNode4": testNodeData["testNode4"],
+			"testNode5": testNodeData["testNode5"],
+		},
+		weights: map[string]int{
+			"testNode1": 1,
+			"testNode2": 1,
+			"testNode3": 1,
+			"testNode4": 1,
+			"testNode5": 1,
+		},
+		shadowed: map[uint64][]edge.Server{},
+		sorted: sorted([]uint64{
+			fnv32("testNode1_1"),
+			fnv32("testNode2_1"),
+			fnv32("testNode3_1"),
+			fnv32("testNode4_1"),
+			fnv32("testNode5_1"),
+
+			fnv32("testNode1_2"),
+			fnv32("testNode2_2"),
+			fnv32("testNode3_2"),
+			fnv32("testNode4_2"),
+			fnv32("testNode5_2"),
 		}),
-		vnodes: map[uint32]edge.Server{
-			hash("testNode1_1"): testNodeData["testNode1"],
-			hash("testNode2_1"): testNodeData["testNode2"],
-			hash("testNode3_1"): testNodeData["testNode3"],
-			hash("testNode4_1"): testNodeData["testNode4"],
-			hash("testNode5_1"): testNodeData["testNode5"],
-
-			hash("testNode1_2"): testNodeData["testNode1"],
-			hash("testNode2_2"): testNodeData["testNode2"],
-			hash("testNode3_2"): testNodeData["testNode3"],
-			hash("testNode4_2"): testNodeData["testNode4"],
-			hash("testNode5_2"): testNodeData["testNode5"],
+		vnodes: map[uint64]edge.Server{
+			fnv32("testNode1_1"): testNodeData["testNode1"],
+			fnv32("testNode2_1"): testNodeData["testNode2"],
+			fnv32("testNode3_1"): testNodeData["testNode3"],
+			fnv32("testNode4_1"): testNodeData["testNode4"],
+			fnv32("testNode5_1"): testNodeData["testNode5"],
+
+			fnv32("testNode1_2"): testNodeData["testNode1"],
+			fnv32("testNode2_2"): testNodeData["testNode2"],
+			fnv32("testNode3_2"): testNodeData["testNode3"],
+			fnv32("testNode4_2"): testNodeData["testNode4"],
+			fnv32("testNode5_2"): testNodeData["testNode5"],
 		},
 		mtx: sync.Mutex{},
 	},
@@ -96,7 +137,53 @@ var testNodeData = map[string]testNode{
 	"testNode5": {val: "testNode5"},
 }
 
-func sorted(slice []uint32) []uint32 {
+// newTestRing copies fixture data, so that tests never modify fixtures.
+func newTestRing(replicas int, nodes map[string]edge.Server, vnodes map[uint64]edge.Server, sorted []uint64) *ring {
+	r := &ring{
+		replicas: replicas,
+		hashFn:   FNV32a,
+		keyFn:    wholeKey,
+		nodes:    map[string]edge.Server{},
+		weights:  map[string]int{},
+		vnodes:   map[uint64]edge.Server{},
+		shadowed: map[uint64][]edge.Server{},
+		sorted:   append([]uint64{}, sorted...),
+		down:     map[string]time.Time{},
+		upTimers: map[string]*time.Timer{},
+
+		subscribers: map[*subscriber]struct{}{},
+		mtx:         sync.Mutex{},
+	}
+	for k, v := range nodes {
+		r.nodes[k] = v
+		r.weights[k] = 1
+	}
+	for k, v := range vnodes {
+		r.vnodes[k] = v
+	}
+	r.publish()
+	return r
+}
+
+func fnv32(s string) uint64 {
+	return FNV32a([]byte(s))
+}
+
+// ringEqual compares ring data, as hash func never deeply equals.
+func ringEqual(a, b *ring) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.replicas == b.replicas &&
+		reflect.DeepEqual(a.nodes, b.nodes) &&
+		reflect.DeepEqual(a.weights, b.weights) &&
+		reflect.DeepEqual(a.vnodes, b.vnodes) &&
+		reflect.DeepEqual(a.shadowed, b.shadowed) &&
+		reflect.DeepEqual(a.sorted, b.sorted) &&
+		reflect.DeepEqual(a.load, b.load)
+}
+
+func sorted(slice []uint64) []uint64 {
 	sort.Slice(slice, func(i, j int) bool { return slice[i] < slice[j] })
 	return slice
 }
@@ -135,7 +222,7 @@ func TestNew(t *testing.T) {
 				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
+			if !ringEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -153,8 +240,9 @@ func (t testNode) String() string {
 func Test_ring_Add(t *testing.T) {
 	type fields struct {
 		replicas int
-		nodes    map[uint32]edge.Server
-		sorted   []uint32
+		nodes    map[string]edge.Server
+		vnodes   map[uint64]edge.Server
+		sorted   []uint64
 	}
 	type args struct {
 		node edge.Server
@@ -169,7 +257,8 @@ func Test_ring_Add(t *testing.T) {
 			"normal",
 			fields{
 				replicas: testRingData["zeroNodeRing"].replicas,
-				nodes:    testRingData["zeroNodeRing"].vnodes,
+				nodes:    testRingData["zeroNodeRing"].nodes,
+				vnodes:   testRingData["zeroNodeRing"].vnodes,
 				sorted:   testRingData["zeroNodeRing"].sorted,
 			},
 			args{
@@ -181,7 +270,8 @@ func Test_ring_Add(t *testing.T) {
 			"duplicate add",
 			fields{
 				replicas: testRingData["oneNodeRing"].replicas,
-				nodes:    testRingData["oneNodeRing"].vnodes,
+				nodes:    testRingData["oneNodeRing"].nodes,
+				vnodes:   testRingData["oneNodeRing"].vnodes,
 				sorted:   testRingData["oneNodeRing"].sorted,
 			},
 			args{
@@ -192,15 +282,10 @@ func Test_ring_Add(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := &ring{
-				replicas: tt.fields.replicas,
-				vnodes:   tt.fields.nodes,
-				sorted:   tt.fields.sorted,
-				mtx:      sync.Mutex{},
-			}
+			got := newTestRing(tt.fields.replicas, tt.fields.nodes, tt.fields.vnodes, tt.fields.sorted)
 			got.Add(tt.args.node)
 
-			if !reflect.DeepEqual(got, tt.want) {
+			if !ringEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -226,8 +311,8 @@ func Test_hash(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := fmt.Sprintf("%x", hash(tt.args.n)); got != tt.want {
-				t.Errorf("hash() = %v, want %v", got, tt.want)
+			if got := fmt.Sprintf("%x", FNV32a([]byte(tt.args.n))); got != tt.want {
+				t.Errorf("FNV32a() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -236,8 +321,9 @@ func Test_hash(t *testing.T) {
 func Test_ring_Get(t *testing.T) {
 	type fields struct {
 		replicas int
-		nodes    map[uint32]edge.Server
-		sorted   []uint32
+		nodes    map[string]edge.Server
+		vnodes   map[uint64]edge.Server
+		sorted   []uint64
 	}
 	type args struct {
 		key string
@@ -252,7 +338,8 @@ func Test_ring_Get(t *testing.T) {
 			"normal",
 			fields{
 				replicas: testRingData["fiveNodeRing"].replicas,
-				nodes:    testRingData["fiveNodeRing"].vnodes,
+				nodes:    testRingData["fiveNodeRing"].nodes,
+				vnodes:   testRingData["fiveNodeRing"].vnodes,
 				sorted:   testRingData["fiveNodeRing"].sorted,
 			},
 			args{
@@ -264,7 +351,8 @@ func Test_ring_Get(t *testing.T) {
 			"zore node",
 			fields{
 				replicas: testRingData["zeroNodeRing"].replicas,
-				nodes:    testRingData["zeroNodeRing"].vnodes,
+				nodes:    testRingData["zeroNodeRing"].nodes,
+				vnodes:   testRingData["zeroNodeRing"].vnodes,
 				sorted:   testRingData["zeroNodeRing"].sorted,
 			},
 			args{
@@ -275,12 +363,7 @@ func Test_ring_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			r := &ring{
-				replicas: tt.fields.replicas,
-				vnodes:   tt.fields.nodes,
-				sorted:   tt.fields.sorted,
-				mtx:      sync.Mutex{},
-			}
+			r := newTestRing(tt.fields.replicas, tt.fields.nodes, tt.fields.vnodes, tt.fields.sorted)
 			if got := r.Get(tt.args.key); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("ring.Get() = %v, want %v", got, tt.want)
 			}
@@ -291,8 +374,9 @@ func Test_ring_Get(t *testing.T) {
 func Test_ring_Remove(t *testing.T) {
 	type fields struct {
 		replicas int
-		nodes    map[uint32]edge.Server
-		sorted   []uint32
+		nodes    map[string]edge.Server
+		vnodes   map[uint64]edge.Server
+		sorted   []uint64
 	}
 	type args struct {
 		node edge.Server
@@ -307,7 +391,8 @@ func Test_ring_Remove(t *testing.T) {
 			"normal",
 			fields{
 				replicas: testRingData["fiveNodeRing"].replicas,
-				nodes:    testRingData["fiveNodeRing"].vnodes,
+				nodes:    testRingData["fiveNodeRing"].nodes,
+				vnodes:   testRingData["fiveNodeRing"].vnodes,
 				sorted:   testRingData["fiveNodeRing"].sorted,
 			},
 			args{
@@ -319,7 +404,8 @@ func Test_ring_Remove(t *testing.T) {
 			"remove not exist",
 			fields{
 				replicas: testRingData["oneNodeRing"].replicas,
-				nodes:    testRingData["oneNodeRing"].vnodes,
+				nodes:    testRingData["oneNodeRing"].nodes,
+				vnodes:   testRingData["oneNodeRing"].vnodes,
 				sorted:   testRingData["oneNodeRing"].sorted,
 			},
 			args{
@@ -330,15 +416,10 @@ func Test_ring_Remove(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := &ring{
-				replicas: tt.fields.replicas,
-				vnodes:   tt.fields.nodes,
-				sorted:   tt.fields.sorted,
-				mtx:      sync.Mutex{},
-			}
+			got := newTestRing(tt.fields.replicas, tt.fields.nodes, tt.fields.vnodes, tt.fields.sorted)
 			got.Remove(tt.args.node)
 
-			if !reflect.DeepEqual(got, tt.want) {
+			if !ringEqual(got, tt.want) {
 				t.Errorf("New() = %v, want %v", got, tt.want)
 			}
 		})
@@ -458,14 +539,53 @@ func TestConsistency(t *testing.T) {
 	}
 }
 
-func BenchmarkGet8(b *testing.B)   { benchmarkGet(b, 8) }
-func BenchmarkGet32(b *testing.B)  { benchmarkGet(b, 32) }
-func BenchmarkGet128(b *testing.B) { benchmarkGet(b, 128) }
-func BenchmarkGet512(b *testing.B) { benchmarkGet(b, 512) }
+func BenchmarkGet8(b *testing.B)   { benchmarkRingGet(b, 8) }
+func BenchmarkGet32(b *testing.B)  { benchmarkRingGet(b, 32) }
+func BenchmarkGet128(b *testing.B) { benchmarkRingGet(b, 128) }
+func BenchmarkGet512(b *testing.B) { benchmarkRingGet(b, 512) }
 
-func benchmarkGet(b *testing.B, nodes int) {
+func benchmarkRingGet(b *testing.B, nodes int) {
 	hash, _ := NewRing(50)
+	benchmarkGet(b, hash, nodes)
+}
 
+// BenchmarkGet runs Get of the other implementations as sub-benchmarks.
+func BenchmarkGet(b *testing.B) {
+	tests := []struct {
+		name  string
+		build func() edge.ConsistentHash
+	}{
+		{"jump", func() edge.ConsistentHash {
+			j, _ := NewJump()
+			return j
+		}},
+		{"rendezvous", func() edge.ConsistentHash {
+			r, _ := NewRendezvous()
+			return r
+		}},
+		{"maglev", func() edge.ConsistentHash {
+			m, _ := NewMaglev(65537)
+			return m
+		}},
+		{"multiprobe", func() edge.ConsistentHash {
+			m, _ := NewMultiProbe(21)
+			return m
+		}},
+		{"ketama", func() edge.ConsistentHash {
+			k, _ := NewKetama()
+			return k
+		}},
+	}
+	for _, tt := range tests {
+		for _, nodes := range []int{8, 32, 128, 512} {
+			b.Run(fmt.Sprintf("%s/%d", tt.name, nodes), func(b *testing.B) {
+				benchmarkGet(b, tt.build(), nodes)
+			})
+		}
+	}
+}
+
+func benchmarkGet(b *testing.B, hash edge.ConsistentHash, nodes int) {
 	var buckets []testNode
 	for i := 0; i < nodes; i++ {
 		buckets = append(buckets, testNode{val: fmt.Sprintf("node-%d", i)})
@@ -579,9 +699,11 @@ func TestKeyDistribution(t *testing.T) {
 		}
 
 		totalBuckets := tt.replicas * tt.nodeCnt
-		allBucketInterval := make([]uint32, 0, totalBuckets)
+		allBucketInterval := make([]uint64, 0, totalBuckets)
 
-		bucketInterval := math.MaxUint32 - h.sorted[totalBuckets-1] + h.sorted[0]
+		// wraps from the last vnode in the space of the hash func
+		mask := uint64(math.MaxUint64) >> (64 - h.hashBits)
+		bucketInterval := (h.sorted[0] - h.sorted[totalBuckets-1]) & mask
 		allBucketInterval = append(allBucketInterval, bucketInterval)
 		for i := 1; i < totalBuckets; i++ {
 			bucketInterval = h.sorted[i] - h.sorted[i-1]
@@ -600,7 +722,7 @@ func TestKeyDistribution(t *testing.T) {
 
 // StandardDeviation returns the standard deviation of the slice
 // as a float
-func StandardDeviation(nums []uint32) (dev float64) {
+func StandardDeviation(nums []uint64) (dev float64) {
 	if len(nums) == 0 {
 		return 0.0
 	}
@@ -616,7 +738,7 @@ func StandardDeviation(nums []uint32) (dev float64) {
 // NormalConfidenceInterval returns the 99% confidence interval for the mean
 // as two float values, the lower and the upper bounds and assuming a normal
 // distribution
-func NormalConfidenceInterval(nums []uint32) (lower, upper float64) {
+func NormalConfidenceInterval(nums []uint64) (lower, upper float64) {
 	conf := 2.57583 // 99% confidence for the mean, http://bit.ly/Mm05eZ
 	mean := Mean(nums)
 	dev := StandardDeviation(nums) / math.Sqrt(float64(len(nums)))
@@ -624,7 +746,7 @@ func NormalConfidenceInterval(nums []uint32) (lower, upper float64) {
 }
 
 // Mean returns the mean of an integer array as a float
-func Mean(nums []uint32) (mean float64) {
+func Mean(nums []uint64) (mean float64) {
 	if len(nums) == 0 {
 		return 0.0
 	}
@@ -633,3 +755,623 @@ func Mean(nums []uint32) (mean float64) {
 	}
 	return mean / float64(len(nums))
 }
+
+func Test_ring_AddNodeRemoveNode(t *testing.T) {
+	r, _ := NewRing(2)
+	if err := r.AddNode(nil); err != ErrNodeInvalid {
+		t.Fatalf("AddNode(nil) error = %v, want %v", err, ErrNodeInvalid)
+	}
+	if err := r.AddNode(testNodeData["testNode1"]); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if err := r.AddNode(testNodeData["testNode1"]); err != ErrNodeExists {
+		t.Fatalf("AddNode() error = %v, want %v", err, ErrNodeExists)
+	}
+	if err := r.RemoveNode(testNodeData["testNode2"]); err != ErrNodeNotFound {
+		t.Fatalf("RemoveNode() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	if err := r.RemoveNode(testNodeData["testNode1"]); err != nil {
+		t.Fatalf("RemoveNode() error = %v", err)
+	}
+	if !ringEqual(r, testRingData["zeroNodeRing"]) {
+		t.Fatalf("RemoveNode() = %v, want %v", r, testRingData["zeroNodeRing"])
+	}
+}
+
+// collidingNodes finds two nodes whose only vnode hash collides.
+func collidingNodes(t *testing.T) (testNode, testNode) {
+	seen := map[uint64]string{}
+	for i := 0; i < 1<<20; i++ {
+		name := fmt.Sprintf("collide-%d", i)
+		h := fnv32(name + "_1")
+		if other, ok := seen[h]; ok {
+			return testNode{val: other}, testNode{val: name}
+		}
+		seen[h] = name
+	}
+	t.Fatalf("no colliding nodes found")
+	return testNode{}, testNode{}
+}
+
+func Test_ring_Collision(t *testing.T) {
+	n1, n2 := collidingNodes(t)
+	small, large := n1, n2
+	if large.val < small.val {
+		small, large = large, small
+	}
+
+	for _, order := range [][]edge.Server{{small, large}, {large, small}} {
+		r, _ := NewRing(1, WithHashFunc(FNV32a, 32))
+		for _, each := range order {
+			if err := r.AddNode(each); err != nil {
+				t.Fatalf("AddNode() error = %v", err)
+			}
+		}
+		if got := r.Get(small.val + "_1"); got != small {
+			t.Fatalf("collided vnode owner = %v, want %v", got, small)
+		}
+		checkRing(t, r)
+
+		if err := r.RemoveNode(small); err != nil {
+			t.Fatalf("RemoveNode() error = %v", err)
+		}
+		if got := r.Get(small.val + "_1"); got != large {
+			t.Fatalf("collided vnode owner = %v, want %v", got, large)
+		}
+		checkRing(t, r)
+	}
+}
+
+func Test_ring_RandomMembership(t *testing.T) {
+	c1, c2 := collidingNodes(t)
+	pool := []edge.Server{c1, c2}
+	for i := 0; i < 30; i++ {
+		pool = append(pool, testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, replicas := range []int{1, 3, 50} {
+		r, _ := NewRing(replicas, WithHashFunc(FNV32a, 32))
+		members := map[string]bool{}
+		for step := 0; step < 500; step++ {
+			node := pool[rnd.Intn(len(pool))]
+			name := node.String()
+			if rnd.Intn(2) == 0 {
+				err := r.AddNode(node)
+				if (err == ErrNodeExists) != members[name] || (err != nil && err != ErrNodeExists) {
+					t.Fatalf("AddNode(%v) error = %v, member %v", name, err, members[name])
+				}
+				members[name] = true
+			} else {
+				err := r.RemoveNode(node)
+				if (err == ErrNodeNotFound) == members[name] || (err != nil && err != ErrNodeNotFound) {
+					t.Fatalf("RemoveNode(%v) error = %v, member %v", name, err, members[name])
+				}
+				delete(members, name)
+			}
+			checkRing(t, r)
+		}
+	}
+}
+
+// checkRing verifies ring invariants, and that the ring equals to a ring
+// built from scratch with the same members.
+func checkRing(t *testing.T, r *ring) {
+	t.Helper()
+
+	if len(r.sorted) != len(r.vnodes) {
+		t.Fatalf("ring sorted %v vnodes, want %v", len(r.sorted), len(r.vnodes))
+	}
+	for i := 1; i < len(r.sorted); i++ {
+		if r.sorted[i-1] >= r.sorted[i] {
+			t.Fatalf("ring sorted not strictly increasing at %v", i)
+		}
+	}
+	for h, owner := range r.vnodes {
+		if r.nodes[idOf(owner)] == nil {
+			t.Fatalf("vnode %v owned by non member %v", h, owner)
+		}
+	}
+	table := r.snapshot()
+	if !reflect.DeepEqual(table.hashes, r.sorted) || len(table.members) != len(r.nodes) {
+		t.Fatalf("ring table not published")
+	}
+	for i, h := range table.hashes {
+		if table.owners[i] != r.vnodes[h] {
+			t.Fatalf("table vnode %v owned by %v, want %v", h, table.owners[i], r.vnodes[h])
+		}
+	}
+
+	names := make([]string, 0, len(r.nodes))
+	for name := range r.nodes {
+		names = append(names, name)
+		for _, h := range r.vnodeHashes(name, r.weights[name]) {
+			owner, ok := r.vnodes[h]
+			if !ok || idOf(owner) > name {
+				t.Fatalf("vnode %v of %v owned by %v", h, name, owner)
+			}
+		}
+	}
+	sort.Strings(names)
+	want, _ := NewRing(r.replicas, WithHashFunc(r.hashFn, int(r.hashBits)))
+	for i := len(names) - 1; i >= 0; i-- {
+		_ = want.AddWeighted(r.nodes[names[i]], r.weights[names[i]])
+	}
+	if !reflect.DeepEqual(r.vnodes, want.vnodes) || !reflect.DeepEqual(r.sorted, want.sorted) {
+		t.Fatalf("ring differs from ring built from scratch")
+	}
+}
+
+type weightedNode struct {
+	testNode
+	weight int
+}
+
+func (w weightedNode) Weight() int {
+	return w.weight
+}
+
+func Test_ring_Weighted(t *testing.T) {
+	r, _ := NewRing(200)
+	small := testNode{val: "small"}
+	large := weightedNode{testNode{val: "large"}, 4}
+	if err := r.AddWeighted(small, 0); err != ErrWeightInvalid {
+		t.Fatalf("AddWeighted() error = %v, want %v", err, ErrWeightInvalid)
+	}
+	if err := r.AddNode(small); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if err := r.AddNode(large); err != nil {
+		t.Fatalf("AddNode() error = %v", err)
+	}
+	if r.Weight(small) != 1 || r.Weight(large) != 4 || len(r.sorted) != 1000 {
+		t.Fatalf("ring weights = %v, %v, vnodes %v", r.Weight(small), r.Weight(large), len(r.sorted))
+	}
+
+	share := func() float64 {
+		hits := 0
+		for i := 0; i < 100000; i++ {
+			if r.Get(strconv.Itoa(i)) == large {
+				hits++
+			}
+		}
+		return float64(hits) / 100000
+	}
+	if got := share(); math.Abs(got-0.8) > 0.1 {
+		t.Fatalf("weighted share = %v, want 0.8", got)
+	}
+
+	if err := r.SetWeight(testNode{val: "unknown"}, 1); err != ErrNodeNotFound {
+		t.Fatalf("SetWeight() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	if err := r.SetWeight(large, 1); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	if got := share(); math.Abs(got-0.5) > 0.1 {
+		t.Fatalf("weighted share = %v, want 0.5", got)
+	}
+	checkRing(t, r)
+
+	before := map[string]edge.Server{}
+	for i := 0; i < 1000; i++ {
+		before[strconv.Itoa(i)] = r.Get(strconv.Itoa(i))
+	}
+	if err := r.SetWeight(small, 3); err != nil {
+		t.Fatalf("SetWeight() error = %v", err)
+	}
+	checkRing(t, r)
+	for key, node := range before {
+		// growing weight of small only moves keys to small
+		if got := r.Get(key); got != node && got != small {
+			t.Fatalf("key %v moved from %v to %v", key, node, got)
+		}
+	}
+}
+
+func Test_ring_GetN(t *testing.T) {
+	r, _ := NewRing(50)
+	if got := r.GetN("key", 3); got != nil {
+		t.Fatalf("GetN() on empty ring = %v, want nil", got)
+	}
+	for i := 1; i <= 5; i++ {
+		r.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		got := r.GetN(key, 3)
+		if len(got) != 3 {
+			t.Fatalf("GetN(%v) = %v, want 3 nodes", key, got)
+		}
+		if got[0] != r.Get(key) {
+			t.Fatalf("GetN(%v) primary = %v, want %v", key, got[0], r.Get(key))
+		}
+		if got[0] == got[1] || got[0] == got[2] || got[1] == got[2] {
+			t.Fatalf("GetN(%v) = %v, want distinct nodes", key, got)
+		}
+		// preference list is stable when a backup leaves
+		r.Remove(got[1])
+		if now := r.GetN(key, 2); now[0] != got[0] || now[1] != got[2] {
+			t.Fatalf("GetN(%v) after removing %v = %v, want %v", key, got[1], now, []edge.Server{got[0], got[2]})
+		}
+		r.Add(got[1])
+	}
+
+	if got := r.GetN("key", 10); len(got) != 5 {
+		t.Fatalf("GetN() = %v, want all 5 nodes", got)
+	}
+	if got := r.GetN("key", 0); got != nil {
+		t.Fatalf("GetN(0) = %v, want nil", got)
+	}
+}
+
+func Test_ring_BoundedLoad(t *testing.T) {
+	if _, err := NewRing(2, WithBoundedLoad(-1)); err == nil {
+		t.Fatalf("NewRing() expected error for negative epsilon")
+	}
+
+	epsilon := 0.25
+	r, _ := NewRing(50, WithBoundedLoad(epsilon))
+	for i := 1; i <= 4; i++ {
+		r.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+	}
+
+	// a single hot key spreads once its node is full
+	acquired := make([]edge.Server, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		acquired = append(acquired, r.Acquire("hot"))
+	}
+	bound := int64(math.Ceil((1 + epsilon) * 1000 / 4))
+	total := int64(0)
+	for i := 1; i <= 4; i++ {
+		load := r.Load(testNodeData[fmt.Sprintf("testNode%d", i)])
+		if load > bound {
+			t.Fatalf("node load = %v, want <= %v", load, bound)
+		}
+		total += load
+	}
+	if hot := r.Load(r.Get("hot")); total != 1000 || hot < bound-1 {
+		t.Fatalf("total load = %v, hot node load = %v, want 1000, about %v", total, hot, bound)
+	}
+
+	for _, each := range acquired {
+		r.Release(each)
+	}
+	for i := 1; i <= 4; i++ {
+		if load := r.Load(testNodeData[fmt.Sprintf("testNode%d", i)]); load != 0 {
+			t.Fatalf("node load after release = %v, want 0", load)
+		}
+	}
+
+	// without load, keys are placed consistently
+	plain, _ := NewRing(50)
+	for i := 1; i <= 4; i++ {
+		plain.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+	}
+	for i := 0; i < 100; i++ {
+		if r.Get(strconv.Itoa(i)) != plain.Get(strconv.Itoa(i)) {
+			t.Fatalf("Get(%v) differs from ring without bounded load", i)
+		}
+	}
+	if plain.Acquire("hot") != plain.Get("hot") || plain.Load(plain.Get("hot")) != 0 {
+		t.Fatalf("Acquire() without bounded load expected same as Get")
+	}
+
+	// an empty ring acquires nil, which is released as nothing
+	empty, _ := NewRing(50, WithBoundedLoad(epsilon))
+	empty.Release(empty.Acquire("key"))
+	if empty.Load(nil) != 0 || empty.Weight(nil) != 0 {
+		t.Fatalf("Load() and Weight() of nil expected 0")
+	}
+}
+
+func Test_ring_HashFunc(t *testing.T) {
+	if _, err := NewRing(2, WithHashFunc(nil, 64)); err == nil {
+		t.Fatalf("NewRing() expected error for nil hash func")
+	}
+	for _, bits := range []int{0, 65} {
+		if _, err := NewRing(2, WithHashFunc(FNV32a, bits)); err == nil {
+			t.Fatalf("NewRing() expected error for %v bits", bits)
+		}
+	}
+
+	// FNV32a places keys as rings of 32-bit positions
+	compatible, _ := NewRing(2, WithHashFunc(FNV32a, 32))
+	for i := 1; i <= 5; i++ {
+		compatible.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+	}
+	if !reflect.DeepEqual(compatible.sorted, testRingData["fiveNodeRing"].sorted) {
+		t.Fatalf("FNV32a ring positions differ from 32-bit ring")
+	}
+	if got := compatible.Get("key"); got != testNodeData["testNode2"] {
+		t.Fatalf("FNV32a ring Get() = %v, want %v", got, testNodeData["testNode2"])
+	}
+
+	for name, fn := range map[string]HashFunc{
+		"xxhash64": XXHash64,
+		"murmur3":  Murmur3,
+		"siphash":  SipHash(1, 2),
+	} {
+		r1, _ := NewRing(100, WithHashFunc(fn, 64))
+		r2, _ := NewRing(100, WithHashFunc(fn, 64))
+		for i := 1; i <= 5; i++ {
+			r1.Add(testNodeData[fmt.Sprintf("testNode%d", i)])
+			r2.Add(testNodeData[fmt.Sprintf("testNode%d", 6-i)])
+		}
+		counts := map[edge.Server]int{}
+		for i := 0; i < 10000; i++ {
+			key := strconv.Itoa(i)
+			if r1.Get(key) != r2.Get(key) {
+				t.Fatalf("%v rings inconsistent on key %v", name, key)
+			}
+			counts[r1.Get(key)]++
+		}
+		for node, count := range counts {
+			if count < 1000 || count > 3000 {
+				t.Fatalf("%v ring node %v got %v keys, want about 2000", name, node, count)
+			}
+		}
+	}
+}
+
+func Test_ring_ConcurrentMembership(t *testing.T) {
+	r, _ := NewRing(50)
+	stable := testNode{val: "stable"}
+	r.Add(stable)
+
+	var writers, readers sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			node := testNode{val: "node" + strconv.Itoa(i)}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r.Add(node)
+				r.Remove(node)
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for j := 0; j < 20000; j++ {
+				key := strconv.Itoa(j)
+				if r.Get(key) == nil {
+					t.Errorf("Get(%v) = nil with stable node", key)
+					return
+				}
+				if nodes := r.GetN(key, 2); len(nodes) == 0 {
+					t.Errorf("GetN(%v) = empty with stable node", key)
+					return
+				}
+			}
+		}()
+	}
+	readers.Wait()
+	close(stop)
+	writers.Wait()
+	checkRing(t, r)
+}
+
+func Test_ring_SetMembers(t *testing.T) {
+	c1, c2 := collidingNodes(t)
+	pool := []edge.Server{c1, c2}
+	for i := 0; i < 20; i++ {
+		pool = append(pool, testNode{val: fmt.Sprintf("node-%d", i)})
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	r, _ := NewRing(3, WithHashFunc(FNV32a, 32))
+	members := map[string]bool{}
+	for step := 0; step < 200; step++ {
+		var nodes []edge.Server
+		next := map[string]bool{}
+		for _, node := range pool {
+			if rnd.Intn(2) == 0 {
+				continue
+			}
+			if w := rnd.Intn(3); w > 0 {
+				node = weightedNode{node.(testNode), w}
+			}
+			nodes = append(nodes, node)
+			next[node.String()] = true
+		}
+
+		added, removed, err := r.SetMembers(nodes)
+		if err != nil {
+			t.Fatalf("SetMembers() error = %v", err)
+		}
+		for _, node := range added {
+			if members[node.String()] || !next[node.String()] {
+				t.Fatalf("SetMembers() added %v unexpectedly", node)
+			}
+		}
+		for _, node := range removed {
+			if !members[node.String()] || next[node.String()] {
+				t.Fatalf("SetMembers() removed %v unexpectedly", node)
+			}
+		}
+		changed := 0
+		for name := range next {
+			if !members[name] {
+				changed++
+			}
+		}
+		for name := range members {
+			if !next[name] {
+				changed++
+			}
+		}
+		if changed != len(added)+len(removed) {
+			t.Fatalf("SetMembers() changed %v nodes, want %v", len(added)+len(removed), changed)
+		}
+		for _, node := range nodes {
+			if r.Weight(node) != weightOf(node) {
+				t.Fatalf("SetMembers() weight of %v = %v, want %v", node, r.Weight(node), weightOf(node))
+			}
+		}
+		members = next
+		checkRing(t, r)
+	}
+
+	invalid := [][]edge.Server{
+		{testNode{val: "a"}, nil},
+		{testNode{val: "a"}, testNode{val: "a"}},
+		{weightedNode{testNode{val: "a"}, 0}},
+	}
+	for _, nodes := range invalid {
+		before := r.snapshot()
+		if _, _, err := r.SetMembers(nodes); err == nil {
+			t.Fatalf("SetMembers(%v) expected error", nodes)
+		}
+		if r.snapshot() != before {
+			t.Fatalf("SetMembers(%v) changed ring on error", nodes)
+		}
+	}
+
+	// members kept are replaced by nodes of the same ID
+	r, _ = NewRing(3)
+	before, after := stableNodes("before"), stableNodes("after")
+	_, _, _ = r.SetMembers(before)
+	for _, node := range after {
+		node.(*stableNode).address = "moved-" + node.(*stableNode).address
+	}
+	if added, removed, _ := r.SetMembers(after); len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("SetMembers() added %v and removed %v, want none", added, removed)
+	}
+	for i := 0; i < 100; i++ {
+		if node := r.Get(strconv.Itoa(i)); node.String()[:len("after")] != "after" {
+			t.Fatalf("Get() = %v, want node replaced", node)
+		}
+	}
+	checkRing(t, r)
+}
+
+type stableNode struct {
+	id      string
+	name    string
+	address string
+	weight  int
+	labels  map[string]string
+}
+
+func (s *stableNode) String() string            { return s.name }
+func (s *stableNode) ID() string                { return s.id }
+func (s *stableNode) Weight() int               { return s.weight }
+func (s *stableNode) Labels() map[string]string { return s.labels }
+func (s *stableNode) Address() string           { return s.address }
+
+func stableNodes(prefix string) []edge.Server {
+	nodes := make([]edge.Server, 0, 5)
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes, &stableNode{
+			id:      fmt.Sprintf("id-%d", i),
+			name:    fmt.Sprintf("%s-%d", prefix, i),
+			address: fmt.Sprintf("10.0.1.%d:11211", i),
+			weight:  1 + i%2,
+			labels:  map[string]string{edge.LabelZone: fmt.Sprintf("zone-%d", i%3)},
+		})
+	}
+	return nodes
+}
+
+func TestNodeID(t *testing.T) {
+	build := map[string]func() edge.ConsistentHash{
+		"ring": func() edge.ConsistentHash {
+			r, _ := NewRing(50)
+			return r
+		},
+		"jump": func() edge.ConsistentHash {
+			j, _ := NewJump()
+			return j
+		},
+		"rendezvous": func() edge.ConsistentHash {
+			r, _ := NewRendezvous()
+			return r
+		},
+		"maglev": func() edge.ConsistentHash {
+			m, _ := NewMaglev(65537)
+			return m
+		},
+		"multiprobe": func() edge.ConsistentHash {
+			m, _ := NewMultiProbe(21)
+			return m
+		},
+		"ketama": func() edge.ConsistentHash {
+			k, _ := NewKetama()
+			return k
+		},
+	}
+	for name, fn := range build {
+		t.Run(name, func(t *testing.T) {
+			before, after := fn(), fn()
+			for i, node := range stableNodes("before") {
+				before.Add(node)
+				after.Add(stableNodes("after")[i])
+			}
+			for i := 0; i < 10000; i++ {
+				key := strconv.Itoa(i)
+				if idOf(before.Get(key)) != idOf(after.Get(key)) {
+					t.Fatalf("Get(%v) moved from %v to %v after renamed", key, before.Get(key), after.Get(key))
+				}
+			}
+
+			// IDs share one namespace with names of other servers
+			adder := before.(interface{ AddNode(edge.Server) error })
+			if err := adder.AddNode(&stableNode{name: "unnamed", weight: 1}); err != ErrNodeInvalid {
+				t.Fatalf("AddNode() of empty ID error = %v, want %v", err, ErrNodeInvalid)
+			}
+			if err := adder.AddNode(testNode{val: "id-0"}); err != ErrNodeExists {
+				t.Fatalf("AddNode() of name as ID error = %v, want %v", err, ErrNodeExists)
+			}
+		})
+	}
+
+	r, _ := NewRing(50)
+	for _, node := range stableNodes("before") {
+		r.Add(node)
+	}
+	renamed := stableNodes("after")
+	if r.Weight(renamed[1]) != 2 {
+		t.Fatalf("Weight() = %v, want 2", r.Weight(renamed[1]))
+	}
+	if err := r.RemoveNode(renamed[0]); err != nil {
+		t.Fatalf("RemoveNode() renamed error = %v", err)
+	}
+	if nodes := r.GetNSpread("key", 3); len(nodes) != 3 || distinctZones(nodes) != 3 {
+		t.Fatalf("GetNSpread() = %v, want 3 zones", nodes)
+	}
+	if _, _, err := r.SetMembers([]edge.Server{&stableNode{name: "unnamed", weight: 1}}); err != ErrNodeInvalid {
+		t.Fatalf("SetMembers() of empty ID error = %v, want %v", err, ErrNodeInvalid)
+	}
+	checkRing(t, r)
+
+	// ketama names points by address, as clients keyed by address do
+	byNode, _ := NewKetama()
+	byAddress, _ := NewKetama()
+	for _, node := range stableNodes("before") {
+		byNode.Add(node)
+		_ = byAddress.AddWeighted(testNode{val: node.(*stableNode).address}, node.(*stableNode).weight)
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if byNode.Get(key).(*stableNode).address != byAddress.Get(key).String() {
+			t.Fatalf("ketama Get(%v) = %v, want %v", key, byNode.Get(key), byAddress.Get(key))
+		}
+	}
+}
+
+func distinctZones(nodes []edge.Server) int {
+	zones := map[string]struct{}{}
+	for _, node := range nodes {
+		zones[node.(edge.LabeledServer).Labels()[edge.LabelZone]] = struct{}{}
+	}
+	return len(zones)
+}
@@ -0,0 +1,250 @@
+package hash
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/cyningsun/edge"
+)
+
+// SlotCount is the number of hash slots of Redis Cluster.
+const SlotCount = 16384
+
+var _ edge.ConsistentHash = &slots{}
+
+// slots routes keys as Redis Cluster does, a key belongs to slot
+// CRC16(key) mod 16384, and every slot range is assigned to a node
+// explicitly. While a slot migrates, its owner serves it, and keys already
+// moved are served by the importing node after ASK redirection.
+// ref: https://redis.io/docs/reference/cluster-spec/
+type slots struct {
+	nodes     map[string]edge.Server
+	owners    [SlotCount]edge.Server
+	importing map[int]edge.Server
+	keyFn     func(key string) string
+	mtx       sync.RWMutex
+}
+
+// NewSlots creates slots, which hashes the hash tag of keys as Redis
+// Cluster does, unless WithKeyExtractor of opts replaces it. Only
+// WithHashTag and WithKeyExtractor of opts apply.
+func NewSlots(opts ...Opt) (*slots, error) {
+	options := newOptions(opts...)
+	if err := options.keyOnly(); err != nil {
+		return nil, err
+	}
+	return &slots{
+		nodes:     map[string]edge.Server{},
+		importing: map[int]edge.Server{},
+		keyFn:     options.keyFnOr(hashTag),
+	}, nil
+}
+
+// Add saves node into cluster without slots, node already exists is ignored.
+func (s *slots) Add(node edge.Server) {
+	_ = s.AddNode(node)
+}
+
+// AddNode saves node into cluster without slots, they are given by Assign.
+func (s *slots) AddNode(node edge.Server) error {
+	slotsVar.Add.Add(1)
+
+	if unnamed(node) {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, exist := s.nodes[name]; exist {
+		return ErrNodeExists
+	}
+	s.nodes[name] = node
+	return nil
+}
+
+// Remove deletes node from cluster, node not exists is ignored.
+func (s *slots) Remove(node edge.Server) {
+	_ = s.RemoveNode(node)
+}
+
+// RemoveNode deletes node from cluster, slots of it become unassigned,
+// and migrations from or to it are aborted.
+func (s *slots) RemoveNode(node edge.Server) error {
+	slotsVar.Remove.Add(1)
+
+	if node == nil {
+		return ErrNodeInvalid
+	}
+	name := idOf(node)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, exist := s.nodes[name]; !exist {
+		return ErrNodeNotFound
+	}
+	for slot, owner := range s.owners {
+		if owner != nil && idOf(owner) == name {
+			s.owners[slot] = nil
+			delete(s.importing, slot)
+		}
+	}
+	for slot, target := range s.importing {
+		if idOf(target) == name {
+			delete(s.importing, slot)
+		}
+	}
+	delete(s.nodes, name)
+	return nil
+}
+
+// Assign gives slots from start to end inclusive to node, aborting their
+// migrations.
+func (s *slots) Assign(start, end int, node edge.Server) error {
+	if err := validSlots(start, end); err != nil {
+		return err
+	}
+	if node == nil {
+		return ErrNodeInvalid
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, exist := s.nodes[idOf(node)]; !exist {
+		return ErrNodeNotFound
+	}
+	for slot := start; slot <= end; slot++ {
+		s.owners[slot] = node
+		delete(s.importing, slot)
+	}
+	return nil
+}
+
+// Migrate starts to move slots from start to end inclusive to node,
+// all of them must be assigned.
+func (s *slots) Migrate(start, end int, to edge.Server) error {
+	if err := validSlots(start, end); err != nil {
+		return err
+	}
+	if to == nil {
+		return ErrNodeInvalid
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, exist := s.nodes[idOf(to)]; !exist {
+		return ErrNodeNotFound
+	}
+	for slot := start; slot <= end; slot++ {
+		if s.owners[slot] == nil {
+			return ErrSlotUnassigned
+		}
+	}
+	for slot := start; slot <= end; slot++ {
+		if idOf(s.owners[slot]) == idOf(to) {
+			continue
+		}
+		s.importing[slot] = to
+	}
+	return nil
+}
+
+// CompleteMigration gives migrating slots from start to end inclusive to
+// the importing nodes, others are unchanged.
+func (s *slots) CompleteMigration(start, end int) error {
+	if err := validSlots(start, end); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for slot := start; slot <= end; slot++ {
+		if to, ok := s.importing[slot]; ok {
+			s.owners[slot] = to
+			delete(s.importing, slot)
+		}
+	}
+	return nil
+}
+
+// AbortMigration keeps migrating slots from start to end inclusive on
+// their owners.
+func (s *slots) AbortMigration(start, end int) error {
+	if err := validSlots(start, end); err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for slot := start; slot <= end; slot++ {
+		delete(s.importing, slot)
+	}
+	return nil
+}
+
+// Get returns the owner of slot of key, nil if the slot is unassigned.
+func (s *slots) Get(key string) edge.Server {
+	slotsVar.Get.Add(1)
+
+	slot := slotOf(s.keyFn(key))
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.owners[slot]
+}
+
+// Route returns the owner of slot of key, and the importing node if the
+// slot is migrating, which serves keys the owner answers ASK for.
+func (s *slots) Route(key string) (owner, importing edge.Server) {
+	slotsVar.Get.Add(1)
+
+	slot := slotOf(s.keyFn(key))
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.owners[slot], s.importing[slot]
+}
+
+// Slot returns hash slot of key, only the hash tag is hashed if key has one.
+func Slot(key string) int {
+	return slotOf(hashTag(key))
+}
+
+func slotOf(tag string) int {
+	return int(crc16([]byte(tag)) % SlotCount)
+}
+
+// hashTag returns substring between the first "{" and the first "}" after
+// it if it is not empty, otherwise the whole key.
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+func validSlots(start, end int) error {
+	if start < 0 || end >= SlotCount || start > end {
+		return ErrSlotInvalid
+	}
+	return nil
+}
+
+// crc16 is CRC16-CCITT (XMODEM), polynomial 0x1021 and initial value 0.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,131 @@
+package hash
+
+import (
+	"testing"
+)
+
+func TestSlot(t *testing.T) {
+	if got := crc16([]byte("123456789")); got != 0x31c3 {
+		t.Fatalf("crc16() = %#x, want 0x31c3", got)
+	}
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"foo", 12182},
+		{"bar", 5061},
+		{"123456789", 12739},
+		{"{user1000}.following", 3443},
+		{"{user1000}.followers", 3443},
+		{"user1000", 3443},
+		{"foo{bar}{zap}", 5061},
+	}
+	for _, tt := range tests {
+		if got := Slot(tt.key); got != tt.want {
+			t.Errorf("Slot(%v) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	tags := map[string]string{
+		"foo":           "foo",
+		"foo{}{bar}":    "foo{}{bar}",
+		"foo{{bar}}zap": "{bar",
+		"foo{bar}{zap}": "bar",
+		"foo{bar":       "foo{bar",
+	}
+	for key, want := range tags {
+		if got := hashTag(key); got != want {
+			t.Errorf("hashTag(%v) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func Test_slots_Assign(t *testing.T) {
+	s, _ := NewSlots()
+	a, b, c := testNode{val: "a"}, testNode{val: "b"}, testNode{val: "c"}
+	if got := s.Get("foo"); got != nil {
+		t.Fatalf("Get() on empty = %v, want nil", got)
+	}
+	if err := s.Assign(0, 100, a); err != ErrNodeNotFound {
+		t.Fatalf("Assign() error = %v, want %v", err, ErrNodeNotFound)
+	}
+	s.Add(a)
+	s.Add(b)
+	s.Add(c)
+	for _, r := range [][2]int{{-1, 10}, {0, SlotCount}, {10, 9}} {
+		if err := s.Assign(r[0], r[1], a); err != ErrSlotInvalid {
+			t.Fatalf("Assign(%v) error = %v, want %v", r, err, ErrSlotInvalid)
+		}
+	}
+	if err := s.Assign(0, 5460, a); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if err := s.Assign(5461, 10922, b); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	if err := s.Assign(10923, SlotCount-1, c); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+
+	// foo is slot 12182, bar is slot 5061
+	if got := s.Get("foo"); got != c {
+		t.Fatalf("Get(foo) = %v, want %v", got, c)
+	}
+	if got := s.Get("bar"); got != a {
+		t.Fatalf("Get(bar) = %v, want %v", got, a)
+	}
+	if got := s.Get("{bar}.suffix"); got != a {
+		t.Fatalf("Get({bar}.suffix) = %v, want %v", got, a)
+	}
+
+	s.Remove(a)
+	if got := s.Get("bar"); got != nil {
+		t.Fatalf("Get(bar) after Remove = %v, want nil", got)
+	}
+	if err := s.Migrate(0, 10, b); err != ErrSlotUnassigned {
+		t.Fatalf("Migrate() error = %v, want %v", err, ErrSlotUnassigned)
+	}
+}
+
+func Test_slots_Migrate(t *testing.T) {
+	s, _ := NewSlots()
+	a, b := testNode{val: "a"}, testNode{val: "b"}
+	s.Add(a)
+	s.Add(b)
+	_ = s.Assign(0, SlotCount-1, a)
+
+	if err := s.Migrate(12000, 12999, b); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if owner, importing := s.Route("foo"); owner != a || importing != b {
+		t.Fatalf("Route(foo) = %v, %v, want %v, %v", owner, importing, a, b)
+	}
+	if owner, importing := s.Route("bar"); owner != a || importing != nil {
+		t.Fatalf("Route(bar) = %v, %v, want %v, nil", owner, importing, a)
+	}
+	if got := s.Get("foo"); got != a {
+		t.Fatalf("Get(foo) while migrating = %v, want %v", got, a)
+	}
+
+	if err := s.AbortMigration(12000, 12099); err != nil {
+		t.Fatalf("AbortMigration() error = %v", err)
+	}
+	if err := s.CompleteMigration(12000, 12999); err != nil {
+		t.Fatalf("CompleteMigration() error = %v", err)
+	}
+	if owner, importing := s.Route("foo"); owner != b || importing != nil {
+		t.Fatalf("Route(foo) = %v, %v, want %v, nil", owner, importing, b)
+	}
+	// slot 12000 was aborted, so it stays on a
+	if got := s.owners[12000]; got != a {
+		t.Fatalf("owner of aborted slot = %v, want %v", got, a)
+	}
+
+	// removing the importing node aborts its migrations
+	_ = s.Migrate(0, 100, b)
+	s.Remove(b)
+	if owner, importing := s.Route(""); owner != a || importing != nil {
+		t.Fatalf("Route() = %v, %v, want %v, nil", owner, importing, a)
+	}
+}
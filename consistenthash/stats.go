@@ -0,0 +1,116 @@
+package hash
+
+import (
+	"math"
+
+	"github.com/cyningsun/edge"
+)
+
+// Stats is the balance of ring. Load of a node is its owned fraction
+// divided by its fair share, weight/totalWeight, so 1 is perfectly balanced.
+type Stats struct {
+	// Nodes is sorted by name
+	Nodes []NodeStats
+	// MaxMeanRatio is max load divided by mean load
+	MaxMeanRatio float64
+	// CoefficientOfVariation is standard deviation of load divided by mean load
+	CoefficientOfVariation float64
+}
+
+type NodeStats struct {
+	Node   edge.Server
+	Weight int
+	Vnodes int
+	// Owned is the fraction of the keyspace, or of sampled keys, of node
+	Owned float64
+}
+
+// Stats returns the keyspace owned by each node, measured by the arcs
+// between vnodes. Nodes down are counted as owning their arcs.
+func (r *ring) Stats() Stats {
+	t := r.snapshot()
+	nodes, index := t.nodeStats()
+	// positions of the hash func are below 2^hashBits
+	space, mask := math.Ldexp(1, int(r.hashBits)), uint64(math.MaxUint64)>>(64-r.hashBits)
+	for i, h := range t.hashes {
+		var arc uint64
+		if i == 0 {
+			// wraps from the last vnode, counting position 0
+			arc = (h - t.hashes[len(t.hashes)-1]) & mask
+		} else {
+			arc = h - t.hashes[i-1]
+		}
+		each := &nodes[index[idOf(t.owners[i])]]
+		each.Vnodes++
+		each.Owned += float64(arc) / space
+	}
+	if len(t.hashes) == 1 {
+		nodes[index[idOf(t.owners[0])]].Owned = 1
+	}
+	return newStats(nodes)
+}
+
+// SampleStats returns the fraction of keys routed to each node by Get,
+// which also counts the key extractor and nodes down, but not loads of
+// bounded load mode.
+func (r *ring) SampleStats(keys []string) Stats {
+	t := r.snapshot()
+	nodes, index := t.nodeStats()
+	for _, key := range keys {
+		if len(t.hashes) == 0 {
+			break
+		}
+		node := t.healthy(t.search(r.hashFn([]byte(r.keyFn(key)))))
+		nodes[index[idOf(node)]].Owned += 1 / float64(len(keys))
+	}
+	for i := range t.owners {
+		nodes[index[idOf(t.owners[i])]].Vnodes++
+	}
+	return newStats(nodes)
+}
+
+// nodeStats returns empty stats of members, and index of them by name.
+func (t *table) nodeStats() ([]NodeStats, map[string]int) {
+	nodes := make([]NodeStats, len(t.members))
+	index := make(map[string]int, len(t.members))
+	for i, each := range t.members {
+		nodes[i] = NodeStats{Node: each.node, Weight: each.weight}
+		index[idOf(each.node)] = i
+	}
+	return nodes, index
+}
+
+func newStats(nodes []NodeStats) Stats {
+	stats := Stats{Nodes: nodes}
+	if len(nodes) == 0 {
+		return stats
+	}
+
+	totalWeight := 0
+	for _, each := range nodes {
+		totalWeight += each.Weight
+	}
+	loads := make([]float64, len(nodes))
+	for i, each := range nodes {
+		loads[i] = each.Owned / (float64(each.Weight) / float64(totalWeight))
+	}
+
+	mean, max := 0.0, 0.0
+	for _, load := range loads {
+		mean += load
+		max = math.Max(max, load)
+	}
+	mean /= float64(len(loads))
+	if mean == 0 {
+		return stats
+	}
+	variance := 0.0
+	for _, load := range loads {
+		variance += (load - mean) * (load - mean)
+	}
+	variance /= float64(len(loads))
+
+	stats.MaxMeanRatio = max / mean
+	stats.CoefficientOfVariation = math.Sqrt(variance) / mean
+	return stats
+}
@@ -0,0 +1,104 @@
+package hash
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_ring_Stats(t *testing.T) {
+	// arcs are measured in the space of the hash func, however wide
+	for _, bits := range []uint{32, 48, 64} {
+		positions := map[string]uint64{"a_1": 1 << (bits - 2), "b_1": 1 << (bits - 1)}
+		r, _ := NewRing(1, WithHashFunc(func(data []byte) uint64 {
+			return positions[string(data)]
+		}, int(bits)))
+		if stats := r.Stats(); len(stats.Nodes) != 0 || stats.MaxMeanRatio != 0 {
+			t.Fatalf("Stats() on empty = %+v", stats)
+		}
+		a, b := testNode{val: "a"}, testNode{val: "b"}
+		r.Add(a)
+		if stats := r.Stats(); stats.Nodes[0].Owned != 1 || stats.MaxMeanRatio != 1 || stats.CoefficientOfVariation != 0 {
+			t.Fatalf("Stats() of one node = %+v", stats)
+		}
+		r.Add(b)
+		stats := r.Stats()
+		want := []NodeStats{{a, 1, 1, 0.75}, {b, 1, 1, 0.25}}
+		for i, each := range want {
+			if stats.Nodes[i] != each {
+				t.Fatalf("%v bits Stats() node = %+v, want %+v", bits, stats.Nodes[i], each)
+			}
+		}
+		if stats.MaxMeanRatio != 1.5 || stats.CoefficientOfVariation != 0.5 {
+			t.Fatalf("%v bits Stats() = %v, %v, want 1.5, 0.5", bits, stats.MaxMeanRatio, stats.CoefficientOfVariation)
+		}
+	}
+}
+
+func Test_ring_StatsBalance(t *testing.T) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		name string
+		fn   HashFunc
+		bits int
+	}{
+		{"fnv32a", FNV32a, 32},
+		{"xxhash64", XXHash64, 64},
+	}
+	for _, tt := range tests {
+		var last float64
+		for _, replicas := range []int{1, 10, 100, 1000} {
+			r, _ := NewRing(replicas, WithHashFunc(tt.fn, tt.bits))
+			for i := 0; i < 10; i++ {
+				r.Add(testNode{val: fmt.Sprintf("node-%d", i)})
+			}
+			_ = r.SetWeight(testNode{val: "node-0"}, 3)
+
+			stats := r.Stats()
+			owned, vnodes := 0.0, 0
+			for _, each := range stats.Nodes {
+				owned += each.Owned
+				vnodes += each.Vnodes
+			}
+			if math.Abs(owned-1) > 1e-9 || vnodes != len(r.sorted) {
+				t.Fatalf("Stats() owned %v by %v vnodes, want 1 by %v", owned, vnodes, len(r.sorted))
+			}
+			if replicas > 1 && stats.CoefficientOfVariation >= last {
+				t.Fatalf("%v replicas %v coefficient of variation %v, want less than %v", tt.name, replicas, stats.CoefficientOfVariation, last)
+			}
+			last = stats.CoefficientOfVariation
+			if stats.MaxMeanRatio < 1 {
+				t.Fatalf("MaxMeanRatio = %v, want at least 1", stats.MaxMeanRatio)
+			}
+
+			sampled := r.SampleStats(keys)
+			for i, each := range sampled.Nodes {
+				if math.Abs(each.Owned-stats.Nodes[i].Owned) > 0.01 {
+					t.Fatalf("sampled %v owned %v, want about %v", each.Node, each.Owned, stats.Nodes[i].Owned)
+				}
+			}
+		}
+		if tt.name == "xxhash64" && last > 0.1 {
+			t.Fatalf("1000 replicas coefficient of variation %v, want balanced", last)
+		}
+	}
+
+	// keys of a node down go to others in samples only
+	r, _ := NewRing(100)
+	down := testNode{val: "down"}
+	r.Add(down)
+	r.Add(testNode{val: "up"})
+	_ = r.MarkDown(down, time.Hour)
+	if got := r.SampleStats(keys).Nodes[0]; got.Node != down || got.Owned != 0 {
+		t.Fatalf("SampleStats() node down = %+v, want no key", got)
+	}
+	if got := r.Stats().Nodes[0]; got.Owned == 0 {
+		t.Fatalf("Stats() node down = %+v, want its arcs", got)
+	}
+}
@@ -0,0 +1,126 @@
+package hash
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+// GetNSpread returns up to n distinct nodes for key like GetN, spreading
+// them over failure domains of edge.LabeledServer. It walks clockwise
+// picking nodes in new domains of every level first, like a new zone, rack
+// and host, then relaxes levels from the widest, so replicas share no rack
+// while enough racks exist, and span at least two zones when possible.
+// Nodes without a label are in a domain of their own at that level.
+func (r *ring) GetNSpread(key string, n int) []edge.Server {
+	ringVar.Get.Add(1)
+
+	h := r.hashFn([]byte(r.keyFn(key)))
+	t := r.snapshot()
+	if n > len(t.members) {
+		n = len(t.members)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	// nodes down fill the rest, spread from domains of nodes up picked
+	used := make([]map[string]struct{}, len(r.domains))
+	for i := range used {
+		used[i] = map[string]struct{}{}
+	}
+	up, down := t.clockwise(t.search(h))
+	nodes := t.spread(up, n, used)
+	if len(nodes) < n {
+		nodes = append(nodes, t.spread(down, n-len(nodes), used)...)
+	}
+	return nodes
+}
+
+// clockwise returns distinct nodes clockwise from the vnode at idx, nodes
+// up and down apart.
+func (t *table) clockwise(idx int) (up, down []edge.Server) {
+	now := time.Now()
+	picked := make(map[string]struct{}, len(t.members))
+	for i := 0; i < len(t.hashes) && len(picked) < len(t.members); i++ {
+		node := t.owners[(idx+i)%len(t.hashes)]
+		if _, dup := picked[idOf(node)]; dup {
+			continue
+		}
+		picked[idOf(node)] = struct{}{}
+		if t.isDown(node, now) {
+			down = append(down, node)
+			continue
+		}
+		up = append(up, node)
+	}
+	return up, down
+}
+
+// spread picks n of candidates in order, in domains of levels from relaxed
+// on not in used, relaxing one more level each pass. Domains of nodes
+// picked are added to used.
+func (t *table) spread(candidates []edge.Server, n int, used []map[string]struct{}) []edge.Server {
+	nodes := make([]edge.Server, 0, n)
+	picked := make([]bool, len(candidates))
+	for relaxed := 0; relaxed <= len(used) && len(nodes) < n; relaxed++ {
+		for i, node := range candidates {
+			if picked[i] || !t.fresh(node, used, relaxed) {
+				continue
+			}
+			picked[i] = true
+			nodes = append(nodes, node)
+			for level, domain := range t.domains[idOf(node)] {
+				if domain != "" {
+					used[level][domain] = struct{}{}
+				}
+			}
+			if len(nodes) == n {
+				break
+			}
+		}
+	}
+	return nodes
+}
+
+// fresh returns whether node is in no used domain of levels from relaxed on.
+func (t *table) fresh(node edge.Server, used []map[string]struct{}, relaxed int) bool {
+	domains := t.domains[idOf(node)]
+	for level := relaxed; level < len(domains); level++ {
+		if domains[level] == "" {
+			continue
+		}
+		if _, ok := used[level][domains[level]]; ok {
+			return false
+		}
+	}
+	return true
+}
+
+// failureDomains returns domains of every level of labeled nodes, each
+// qualified by its wider domains, as racks of two zones may share a name.
+// mtx must be held.
+func (r *ring) failureDomains() map[string][]string {
+	var domains map[string][]string
+	for name, node := range r.nodes {
+		labeled, ok := node.(edge.LabeledServer)
+		if !ok {
+			continue
+		}
+		labels := labeled.Labels()
+		path := make([]string, 0, len(r.domains))
+		each := make([]string, len(r.domains))
+		for level, label := range r.domains {
+			path = append(path, labels[label])
+			if labels[label] != "" {
+				each[level] = strings.Join(path, "/")
+			}
+		}
+		if domains == nil {
+			domains = map[string][]string{}
+		}
+		domains[name] = each
+	}
+	return domains
+}
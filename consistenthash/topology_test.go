@@ -0,0 +1,149 @@
+package hash
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cyningsun/edge"
+)
+
+type labeledNode struct {
+	testNode
+	labels map[string]string
+}
+
+func (l *labeledNode) Labels() map[string]string {
+	return l.labels
+}
+
+func newLabeledNode(zone, rack, host string) *labeledNode {
+	return &labeledNode{
+		testNode{val: zone + "-" + rack + "-" + host},
+		map[string]string{edge.LabelZone: zone, edge.LabelRack: rack, edge.LabelHost: host},
+	}
+}
+
+func distinct(nodes []edge.Server, label string) int {
+	seen := map[string]struct{}{}
+	for _, node := range nodes {
+		labels := node.(*labeledNode).labels
+		seen[labels[edge.LabelZone]+"/"+labels[label]] = struct{}{}
+	}
+	return len(seen)
+}
+
+func Test_ring_GetNSpread(t *testing.T) {
+	r, _ := NewRing(50)
+	if got := r.GetNSpread("key", 3); got != nil {
+		t.Fatalf("GetNSpread() on empty = %v, want nil", got)
+	}
+	// racks of zones share names
+	for _, zone := range []string{"a", "b", "c"} {
+		for _, rack := range []string{"r1", "r2"} {
+			for _, host := range []string{"h1", "h2"} {
+				r.Add(newLabeledNode(zone, rack, host))
+			}
+		}
+	}
+
+	tests := []struct {
+		n     int
+		zones int
+		racks int
+	}{
+		{1, 1, 1},
+		{3, 3, 3},
+		{6, 3, 6},
+		{8, 3, 6},
+		{12, 3, 6},
+		{20, 3, 6},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.n), func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i)
+				nodes := r.GetNSpread(key, tt.n)
+				want := tt.n
+				if want > 12 {
+					want = 12
+				}
+				if len(nodes) != want || nodes[0] != r.Get(key) {
+					t.Fatalf("GetNSpread(%v) = %v, want %v nodes starting with %v", key, nodes, want, r.Get(key))
+				}
+				if zones := distinct(nodes, edge.LabelZone); zones != tt.zones {
+					t.Fatalf("GetNSpread(%v) = %v in %v zones, want %v", key, nodes, zones, tt.zones)
+				}
+				if racks := distinct(nodes, edge.LabelRack); racks != tt.racks {
+					t.Fatalf("GetNSpread(%v) = %v in %v racks, want %v", key, nodes, racks, tt.racks)
+				}
+				if racks := distinct(nodes[:tt.racks], edge.LabelRack); racks != tt.racks {
+					t.Fatalf("GetNSpread(%v) = %v, want the first %v in distinct racks", key, nodes, tt.racks)
+				}
+			}
+		})
+	}
+}
+
+func Test_ring_GetNSpreadUneven(t *testing.T) {
+	r, _ := NewRing(50)
+	for i := 0; i < 5; i++ {
+		r.Add(newLabeledNode("big", fmt.Sprintf("r%d", i), "h"))
+	}
+	small := newLabeledNode("small", "r0", "h")
+	r.Add(small)
+	r.Add(testNode{val: "unlabeled"})
+
+	for i := 0; i < 1000; i++ {
+		nodes := r.GetNSpread(strconv.Itoa(i), 2)
+		if nodes[0] != small && nodes[0].String() != "unlabeled" && nodes[1] != small && nodes[1].String() != "unlabeled" {
+			t.Fatalf("GetNSpread() = %v, want two zones", nodes)
+		}
+	}
+
+	_ = r.MarkDown(small, time.Hour)
+	for i := 0; i < 1000; i++ {
+		nodes := r.GetNSpread(strconv.Itoa(i), 7)
+		if nodes[6] != small {
+			t.Fatalf("GetNSpread() = %v, want %v down last", nodes, small)
+		}
+	}
+}
+
+func Test_ring_GetNSpreadDown(t *testing.T) {
+	r, _ := NewRing(50)
+	for _, rack := range []string{"r1", "r2", "r3", "r4"} {
+		for _, host := range []string{"h1", "h2"} {
+			node := newLabeledNode("a", rack, host)
+			r.Add(node)
+			// only h1 of r1 and r2 are up
+			if host == "h2" || rack == "r3" || rack == "r4" {
+				_ = r.MarkDown(node, time.Hour)
+			}
+		}
+	}
+	// nodes down share no rack with nodes up while other racks exist
+	for i := 0; i < 1000; i++ {
+		nodes := r.GetNSpread(strconv.Itoa(i), 4)
+		if racks := distinct(nodes, edge.LabelRack); racks != 4 {
+			t.Fatalf("GetNSpread() = %v in %v racks, want 4", nodes, racks)
+		}
+	}
+}
+
+func Test_ring_WithFailureDomains(t *testing.T) {
+	r, _ := NewRing(50, WithFailureDomains(edge.LabelHost))
+	for _, rack := range []string{"r1", "r2"} {
+		for _, host := range []string{"h1", "h2"} {
+			r.Add(newLabeledNode("a", rack, host))
+		}
+	}
+	// only hosts are failure domains, so h1 of both racks is one domain
+	for i := 0; i < 1000; i++ {
+		nodes := r.GetNSpread(strconv.Itoa(i), 2)
+		if nodes[0].(*labeledNode).labels[edge.LabelHost] == nodes[1].(*labeledNode).labels[edge.LabelHost] {
+			t.Fatalf("GetNSpread() = %v, want distinct hosts", nodes)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package disk
+
+import (
+	"expvar"
+)
+
+var m = struct {
+	CompactError *expvar.Int
+}{
+	CompactError: expvar.NewInt("cache.disk.compact.error"),
+}
@@ -0,0 +1,302 @@
+// Package disk implements append-only log storage with in-memory index
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// record layout:
+	// crc32(4) | kind(1) | keyLen(4) | valLen(4) | headerCrc32(4) | key | val
+	// crc32 covers all after it, headerCrc32 covers kind and lengths, so a
+	// broken length is told apart from a record torn by crash
+	headerSize = 17
+
+	kindPut    byte = 1
+	kindDelete byte = 2
+
+	// compaction is worthwhile only when garbage is both large and dominant
+	minCompactSize = 1 << 20
+)
+
+var ErrCorrupted = errors.New("disk log corrupted")
+
+type entry struct {
+	offset int64
+	size   int64
+}
+
+// Log keeps every write as a record appended to a single file, and the
+// offset of the latest record of each key in memory.
+// Records overwritten or deleted are garbage, reclaimed by Compact.
+type Log struct {
+	path    string
+	file    *os.File
+	index   map[string]entry
+	size    int64
+	garbage int64
+	mtx     sync.RWMutex
+}
+
+// Open opens or creates the log at path, rebuilding index from records.
+// A torn tail left by crash, which is an incomplete or broken last record,
+// is truncated. A broken header, or a broken record followed by others,
+// fails with ErrCorrupted, leaving the file as is.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{
+		path:  path,
+		file:  f,
+		index: make(map[string]entry),
+	}
+	if err := l.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) load() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(l.file)
+	header := make([]byte, headerSize)
+	offset := int64(0)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(header[4:13]) != binary.BigEndian.Uint32(header[13:]) {
+			return ErrCorrupted
+		}
+		kind, keyLen, valLen := decodeHeader(header)
+		size := int64(headerSize) + int64(keyLen) + int64(valLen)
+		if offset+size > info.Size() {
+			break
+		}
+		body := make([]byte, keyLen+valLen)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		if crc32.ChecksumIEEE(append(header[4:], body...)) != binary.BigEndian.Uint32(header) {
+			if offset+size == info.Size() {
+				break
+			}
+			return ErrCorrupted
+		}
+
+		key := string(body[:keyLen])
+		if old, ok := l.index[key]; ok {
+			l.garbage += old.size
+		}
+		switch kind {
+		case kindPut:
+			l.index[key] = entry{offset, size}
+		case kindDelete:
+			delete(l.index, key)
+			l.garbage += size
+		default:
+			return ErrCorrupted
+		}
+		offset += size
+	}
+
+	l.size = offset
+	if err = l.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err = l.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Get returns the latest value of key.
+func (l *Log) Get(key string) ([]byte, bool, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	e, ok := l.index[key]
+	if !ok {
+		return nil, false, nil
+	}
+	record := make([]byte, e.size)
+	if _, err := l.file.ReadAt(record, e.offset); err != nil {
+		return nil, false, err
+	}
+	_, keyLen, _ := decodeHeader(record)
+	return record[headerSize+keyLen:], true, nil
+}
+
+// Put appends val as the latest value of key.
+func (l *Log) Put(key string, val []byte) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	offset := l.size
+	size, err := l.append(kindPut, key, val)
+	if err != nil {
+		return err
+	}
+	if old, ok := l.index[key]; ok {
+		l.garbage += old.size
+	}
+	l.index[key] = entry{offset, size}
+	l.maybeCompact()
+	return nil
+}
+
+// Delete appends a tombstone of key if it exists.
+func (l *Log) Delete(key string) (bool, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	old, ok := l.index[key]
+	if !ok {
+		return false, nil
+	}
+	size, err := l.append(kindDelete, key, nil)
+	if err != nil {
+		return false, err
+	}
+	delete(l.index, key)
+	l.garbage += old.size + size
+	l.maybeCompact()
+	return true, nil
+}
+
+// Exists returns whether key has a value, without reading disk.
+func (l *Log) Exists(key string) bool {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	_, ok := l.index[key]
+	return ok
+}
+
+// Len returns how many keys have a value.
+func (l *Log) Len() int {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	return len(l.index)
+}
+
+// Size returns bytes used by the log file, including garbage.
+func (l *Log) Size() int64 {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	return l.size
+}
+
+// Compact rewrites live records into a new file and replaces the log.
+func (l *Log) Compact() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.compact()
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	return l.file.Close()
+}
+
+func (l *Log) append(kind byte, key string, val []byte) (int64, error) {
+	record := encode(kind, key, val)
+	if _, err := l.file.Write(record); err != nil {
+		// drop the partial record, so later appends stay readable
+		_ = l.file.Truncate(l.size)
+		_, _ = l.file.Seek(l.size, io.SeekStart)
+		return 0, err
+	}
+	l.size += int64(len(record))
+	return int64(len(record)), nil
+}
+
+// maybeCompact compacts when garbage is worth it. The write done already
+// stays durable if compaction fails, so its error is only counted, and
+// the log is compacted again on a later write.
+func (l *Log) maybeCompact() {
+	if l.garbage < minCompactSize || l.garbage < l.size/2 {
+		return
+	}
+	if err := l.compact(); err != nil {
+		m.CompactError.Add(1)
+	}
+}
+
+func (l *Log) compact() error {
+	tmpPath := l.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]entry, len(l.index))
+	w := bufio.NewWriter(tmp)
+	offset := int64(0)
+	for key, e := range l.index {
+		record := make([]byte, e.size)
+		if _, err = l.file.ReadAt(record, e.offset); err != nil {
+			break
+		}
+		if _, err = w.Write(record); err != nil {
+			break
+		}
+		index[key] = entry{offset, e.size}
+		offset += e.size
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, l.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// tmp is positioned at its end already, ready for later appends
+	l.file.Close()
+	l.file = tmp
+	l.index = index
+	l.size = offset
+	l.garbage = 0
+	return nil
+}
+
+func encode(kind byte, key string, val []byte) []byte {
+	record := make([]byte, headerSize+len(key)+len(val))
+	record[4] = kind
+	binary.BigEndian.PutUint32(record[5:], uint32(len(key)))
+	binary.BigEndian.PutUint32(record[9:], uint32(len(val)))
+	binary.BigEndian.PutUint32(record[13:], crc32.ChecksumIEEE(record[4:13]))
+	copy(record[headerSize:], key)
+	copy(record[headerSize+len(key):], val)
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+func decodeHeader(header []byte) (kind byte, keyLen, valLen int) {
+	return header[4], int(binary.BigEndian.Uint32(header[5:])), int(binary.BigEndian.Uint32(header[9:]))
+}
@@ -0,0 +1,176 @@
+package disk
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func openTemp(t *testing.T) (*Log, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open err: %v", err)
+	}
+	return l, path
+}
+
+func expectValue(t *testing.T, l *Log, key, want string) {
+	t.Helper()
+	val, ok, err := l.Get(key)
+	if err != nil || !ok || !bytes.Equal(val, []byte(want)) {
+		t.Fatalf("Get(%v) = %q, %v, %v, want %q", key, val, ok, err, want)
+	}
+}
+
+func TestLog_Replay(t *testing.T) {
+	l, path := openTemp(t)
+	_ = l.Put("a", []byte("1"))
+	_ = l.Put("b", []byte("2"))
+	_ = l.Put("a", []byte("3"))
+	if ok, err := l.Delete("b"); !ok || err != nil {
+		t.Fatalf("Delete() = %v, %v", ok, err)
+	}
+	if ok, _ := l.Delete("b"); ok {
+		t.Fatalf("Delete() of deleted key expected false")
+	}
+	size := l.Size()
+	l.Close()
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open err: %v", err)
+	}
+	defer l.Close()
+	expectValue(t, l, "a", "3")
+	if l.Exists("b") || l.Len() != 1 || l.Size() != size {
+		t.Fatalf("replay got exists %v, len %v, size %v", l.Exists("b"), l.Len(), l.Size())
+	}
+	if l.garbage != size-int64(headerSize+2) {
+		t.Fatalf("replay garbage = %v, want %v", l.garbage, size-int64(headerSize+2))
+	}
+}
+
+func TestLog_TornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tear func(record []byte) []byte
+	}{
+		{"partial header", func(record []byte) []byte { return record[:headerSize-1] }},
+		{"partial body", func(record []byte) []byte { return record[:len(record)-1] }},
+		{"broken crc", func(record []byte) []byte {
+			record[len(record)-1] ^= 0xff
+			return record
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, path := openTemp(t)
+			_ = l.Put("a", []byte("1"))
+			size := l.Size()
+			l.Close()
+
+			f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			_, _ = f.Write(tt.tear(encode(kindPut, "b", []byte("2"))))
+			f.Close()
+
+			l, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open err: %v", err)
+			}
+			defer l.Close()
+			expectValue(t, l, "a", "1")
+			if l.Exists("b") || l.Size() != size {
+				t.Fatalf("torn tail expected truncated, size %v, want %v", l.Size(), size)
+			}
+			if info, _ := os.Stat(path); info.Size() != size {
+				t.Fatalf("file size = %v, want %v", info.Size(), size)
+			}
+			_ = l.Put("c", []byte("3"))
+			expectValue(t, l, "c", "3")
+		})
+	}
+}
+
+func TestLog_Corrupted(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int64
+	}{
+		{"key", headerSize},
+		{"key length", 5},
+		{"value length", 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, path := openTemp(t)
+			_ = l.Put("a", []byte("1"))
+			_ = l.Put("b", []byte("2"))
+			_ = l.Put("c", []byte("3"))
+			l.Close()
+
+			// break the first record
+			f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+			_, _ = f.WriteAt([]byte{0x7f}, tt.offset)
+			f.Close()
+
+			if _, err := Open(path); err != ErrCorrupted {
+				t.Fatalf("Open err = %v, want %v", err, ErrCorrupted)
+			}
+			if info, _ := os.Stat(path); info.Size() != int64(3*(headerSize+2)) {
+				t.Fatalf("corrupted file expected kept, size %v", info.Size())
+			}
+		})
+	}
+}
+
+func TestLog_Compact(t *testing.T) {
+	l, path := openTemp(t)
+	for i := 0; i < 100; i++ {
+		_ = l.Put("key", []byte(strconv.Itoa(i)))
+		_ = l.Put(strconv.Itoa(i), []byte("val"))
+		_, _ = l.Delete(strconv.Itoa(i))
+	}
+	before := l.Size()
+	if err := l.Compact(); err != nil {
+		t.Fatalf("Compact err: %v", err)
+	}
+	if l.Size() >= before || l.Len() != 1 || l.garbage != 0 {
+		t.Fatalf("Compact got size %v of %v, len %v, garbage %v", l.Size(), before, l.Len(), l.garbage)
+	}
+	expectValue(t, l, "key", "99")
+	_ = l.Put("after", []byte("compact"))
+	l.Close()
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open err: %v", err)
+	}
+	defer l.Close()
+	expectValue(t, l, "key", "99")
+	expectValue(t, l, "after", "compact")
+}
+
+func TestLog_CompactError(t *testing.T) {
+	l, path := openTemp(t)
+	defer l.Close()
+	// compaction fails to create its file
+	if err := os.Mkdir(path+".compact", 0755); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	errors := m.CompactError.Value()
+	val := make([]byte, minCompactSize/4)
+	for i := 0; i < 8; i++ {
+		if err := l.Put("key", val); err != nil {
+			t.Fatalf("Put err: %v", err)
+		}
+	}
+	if m.CompactError.Value() == errors {
+		t.Fatalf("compaction error expected counted")
+	}
+	expectValue(t, l, "key", string(val))
+}
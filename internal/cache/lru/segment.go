@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"reflect"
 	"sync"
 )
 
@@ -10,11 +11,15 @@ type entry struct {
 	val interface{}
 }
 
+// EvictFunc is called with the entry removed to make room for a new one.
+type EvictFunc func(key string, val interface{})
+
 type Segment struct {
-	cache map[interface{}]*list.Element
-	ll    *list.List
-	mtx   sync.RWMutex
-	cap   int
+	cache   map[interface{}]*list.Element
+	ll      *list.List
+	mtx     sync.RWMutex
+	cap     int
+	onEvict EvictFunc
 }
 
 func NewSegment(c int) *Segment {
@@ -25,29 +30,106 @@ func NewSegment(c int) *Segment {
 	}
 }
 
+// OnEvict registers fn to be called with every entry evicted.
+// fn is called under the segment lock, so the entry is never seen missing
+// before fn records it, and fn must not access the segment.
+func (s *Segment) OnEvict(fn EvictFunc) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.onEvict = fn
+}
+
 func (s *Segment) Set(key string, val interface{}) interface{} {
 	m.Set.Add(1)
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	if s.cache == nil {
-		s.cache = make(map[interface{}]*list.Element)
-		s.ll = list.New()
-	}
-	if found, ok := s.cache[key]; ok {
+	if found, ok := s.lookup(key); ok {
 		s.ll.MoveToFront(found)
 		oldVal := found.Value.(*entry).val
 		found.Value.(*entry).val = val
 		return oldVal
 	}
-	new := s.ll.PushFront(&entry{key, val})
-	s.cache[key] = new
+	s.insert(key, val)
+	return nil
+}
 
-	if s.cap != 0 && s.ll.Len() > s.cap {
-		m.Evict.Add(1)
-		s.removeOldest()
+// SetIfAbsent saves value under the key only if key not exist.
+// If key already exist, <existing value, true> will be return
+func (s *Segment) SetIfAbsent(key string, val interface{}) (actual interface{}, loaded bool) {
+	m.Set.Add(1)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if found, ok := s.lookup(key); ok {
+		s.ll.MoveToFront(found)
+		return found.Value.(*entry).val, true
 	}
-	return nil
+	s.insert(key, val)
+	return val, false
+}
+
+// Replace saves value under the key only if key already exist.
+// If key not exist, <nil, false> will be return
+func (s *Segment) Replace(key string, val interface{}) (old interface{}, replaced bool) {
+	m.Set.Add(1)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	found, ok := s.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(found)
+	old = found.Value.(*entry).val
+	found.Value.(*entry).val = val
+	return old, true
+}
+
+// CompareAndSwap saves new under the key only if key exist and its value
+// equals to old. Values of uncomparable type never equal.
+func (s *Segment) CompareAndSwap(key string, old, new interface{}) (swapped bool) {
+	m.Set.Add(1)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	found, ok := s.lookup(key)
+	if !ok || !equal(found.Value.(*entry).val, old) {
+		return false
+	}
+	s.ll.MoveToFront(found)
+	found.Value.(*entry).val = new
+	return true
+}
+
+// Compute calls fn with the current value under the key, then saves the
+// value returned if keep, or deletes the key otherwise.
+// fn is called under the segment lock, so it must not access the segment.
+func (s *Segment) Compute(key string, fn func(old interface{}, exists bool) (val interface{}, keep bool)) (val interface{}, ok bool) {
+	m.Set.Add(1)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	found, exists := s.lookup(key)
+	var old interface{}
+	if exists {
+		old = found.Value.(*entry).val
+	}
+	val, ok = fn(old, exists)
+	switch {
+	case ok && exists:
+		s.ll.MoveToFront(found)
+		found.Value.(*entry).val = val
+	case ok:
+		s.insert(key, val)
+	case exists:
+		s.removeElement(found)
+		val = nil
+	default:
+		val = nil
+	}
+	return val, ok
 }
 
 func (s *Segment) Get(key string) (val interface{}, ok bool) {
@@ -103,14 +185,36 @@ func (s *Segment) Len() int {
 	return s.ll.Len()
 }
 
-func (s *Segment) removeOldest() {
+func (s *Segment) lookup(key string) (*list.Element, bool) {
 	if s.cache == nil {
-		return
+		s.cache = make(map[interface{}]*list.Element)
+		s.ll = list.New()
+	}
+	found, ok := s.cache[key]
+	return found, ok
+}
+
+// insert adds a new entry, evicting the oldest one if over capacity.
+func (s *Segment) insert(key string, val interface{}) {
+	s.cache[key] = s.ll.PushFront(&entry{key, val})
+	if s.cap != 0 && s.ll.Len() > s.cap {
+		m.Evict.Add(1)
+		if evicted := s.removeOldest(); evicted != nil && s.onEvict != nil {
+			s.onEvict(evicted.key, evicted.val)
+		}
+	}
+}
+
+func (s *Segment) removeOldest() *entry {
+	if s.cache == nil {
+		return nil
 	}
 	found := s.ll.Back()
 	if found != nil {
 		s.removeElement(found)
+		return found.Value.(*entry)
 	}
+	return nil
 }
 
 func (s *Segment) removeElement(e *list.Element) {
@@ -118,3 +222,22 @@ func (s *Segment) removeElement(e *list.Element) {
 	kv := e.Value.(*entry)
 	delete(s.cache, kv.key)
 }
+
+// equal returns whether a == b, false if they are uncomparable. A type
+// comparable by reflect, like a struct of interface fields, still panics
+// on == when it holds a slice, map or func, which is recovered.
+func equal(a, b interface{}) (eq bool) {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ta := reflect.TypeOf(a)
+	if ta != reflect.TypeOf(b) || !ta.Comparable() {
+		return false
+	}
+	defer func() {
+		if recover() != nil {
+			eq = false
+		}
+	}()
+	return a == b
+}